@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"go-reloaded/internal/pipeline"
+)
+
+// update rewrites the expected outputs instead of comparing against them:
+//
+//	go test -run TestGolden -update
+var update = flag.Bool("update", false, "rewrite golden *.out.txt files with the current output")
+
+// goldenDir holds the golden cases: every NAME.in.txt is processed and
+// compared with NAME.out.txt. The cases from docs/GOLDEN-TEST-SET.md
+// are numbered after their section in that document.
+const goldenDir = "tests/testdata"
+
+func TestGolden(t *testing.T) {
+	var inputs []string
+	err := filepath.WalkDir(goldenDir, func(path string, d fs.DirEntry, err error) error {
+		if err == nil && !d.IsDir() && strings.HasSuffix(path, ".in.txt") {
+			inputs = append(inputs, path)
+		}
+		return err
+	})
+	if err != nil {
+		t.Fatalf("reading %s: %v", goldenDir, err)
+	}
+	if len(inputs) == 0 {
+		t.Fatalf("no golden cases found in %s", goldenDir)
+	}
+
+	for _, inPath := range inputs {
+		base := strings.TrimSuffix(inPath, ".in.txt")
+		name, _ := filepath.Rel(goldenDir, base)
+		outPath := base + ".out.txt"
+
+		t.Run(filepath.ToSlash(name), func(t *testing.T) {
+			input, err := os.ReadFile(inPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			result := pipeline.ProcessText(string(input))
+
+			if *update {
+				if err := os.WriteFile(outPath, []byte(result), 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+
+			expected, err := os.ReadFile(outPath)
+			if err != nil {
+				t.Fatalf("missing expected output (run with -update to create it): %v", err)
+			}
+			if result != string(expected) {
+				t.Errorf("%s\n  got: %q\n want: %q", inPath, result, expected)
+			}
+		})
+	}
+}
@@ -1,9 +1,19 @@
 package main
 
 import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
 	"testing"
+	"unicode"
+	"unicode/utf8"
 
 	"go-reloaded/internal/pipeline"
+	"go-reloaded/internal/tokenizer"
+	"go-reloaded/internal/transform"
+	"go-reloaded/reloaded"
 )
 
 func TestProcessTextIntegration(t *testing.T) {
@@ -78,9 +88,14 @@ func TestProcessTextIntegration(t *testing.T) {
 			expected: "",
 		},
 		{
-			name:     "only spaces",
+			name:     "only spaces are kept",
 			input:    "   ",
-			expected: "",
+			expected: "   ",
+		},
+		{
+			name:     "indentation and trailing newline are kept",
+			input:    "  - a apple (up) ,\n\t\n\tif x :  \n",
+			expected: "  - an APPLE,\n\t\n\tif x:  \n",
 		},
 		{
 			name:     "newline preservation",
@@ -92,6 +107,56 @@ func TestProcessTextIntegration(t *testing.T) {
 			input:    "Line 1\n\nLine 3",
 			expected: "Line 1\n\nLine 3",
 		},
+		{
+			name:     "range and forward markers",
+			input:    "(up:start) read this (up:end) then (cap, +2) new york .",
+			expected: "READ THIS then New York.",
+		},
+		{
+			name:     "tolerant marker syntax",
+			input:    "shout this (UP) and these two (up,2) but not (up, 2, extra)",
+			expected: "shout THIS and THESE TWO but not (up, 2, extra)",
+		},
+		{
+			name:     "escaped markers are kept literally",
+			input:    "type \\(up) to shout (up) , \\(hex) is 1E (hex)",
+			expected: "type (up) to SHOUT, (hex) is 30",
+		},
+		{
+			name:     "escaped markers with arguments are kept literally",
+			input:    "code \\(up, 2) here , and \\(low, 3) there",
+			expected: "code (up, 2) here, and (low, 3) there",
+		},
+		{
+			name:     "parenthesized prose gets punctuation and article fixes",
+			input:    "read this (see a appendix , please) now",
+			expected: "read this (see an appendix, please) now",
+		},
+		{
+			name:     "prose starting with a marker name is not a marker",
+			input:    "we climbed (up a old hill , slowly) today, (low and slow)",
+			expected: "we climbed (up an old hill, slowly) today, (low and slow)",
+		},
+		{
+			name:     "malformed markers are kept as written and not counted",
+			input:    "this is (up, ) wrong, (up,  3x ) too\na b (up, 2, extra) (up, 2)",
+			expected: "this is (up, ) wrong, (up,  3x ) too\nA B (up, 2, extra)",
+		},
+		{
+			name:     "markers after quoted words",
+			input:    "\"Hi!\"(cap) \"Wait... (cap)\" 'hi' (cap) \"hello world\" (pascal, 2)",
+			expected: "\"Hi!\" \"Wait...\" 'Hi' \"HelloWorld\"",
+		},
+		{
+			name:     "guillemets around articles and numbers",
+			input:    "«a apple» and «1E (hex)»",
+			expected: "«an apple» and «30»",
+		},
+		{
+			name:     "identifier markers",
+			input:    "set the user account id (snake, 3) field .",
+			expected: "set the user_account_id field.",
+		},
 	}
 
 	for _, tt := range tests {
@@ -103,3 +168,442 @@ func TestProcessTextIntegration(t *testing.T) {
 		})
 	}
 }
+
+func TestProcessCustomMarkers(t *testing.T) {
+	markers, err := transform.ParseCustomMarkers([]byte(`{"markers": {
+		"brand":  {"action": "table", "table": {"github": "GitHub"}},
+		"redact": {"action": "replace", "with": "█████"},
+		"em":     {"action": "wrap", "prefix": "*", "suffix": "*"}
+	}}`))
+	if err != nil {
+		t.Fatalf("ParseCustomMarkers: %v", err)
+	}
+	tests := []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "custom markers",
+			input:    "push to github (brand) , password hunter two (redact, 2) (up)",
+			expected: "push to GitHub, password █████ █████",
+		},
+		{
+			name:     "custom and built-in markers apply left to right",
+			input:    "github (up) (brand) and GITHUB (brand) (low)",
+			expected: "GitHub and github",
+		},
+		{
+			name:     "number markers look back past custom markers",
+			input:    "1E (em) (hex) and 101 (bin) (em)",
+			expected: "*30* and *5*",
+		},
+		{
+			name:     "custom markers are not counted as words",
+			input:    "hello world (em) (up, 2)",
+			expected: "HELLO *WORLD*",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := pipeline.ProcessTextWithOptions(tt.input, pipeline.Options{CustomMarkers: markers})
+			if result != tt.expected {
+				t.Errorf("ProcessTextWithOptions(%q)\n  got: %q\n want: %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestProcessLangSpacing(t *testing.T) {
+	input := "Il a dit : « bonjour (cap) , ça va ? »"
+	expected := "Il a dit\u00a0: «\u00a0Bonjour, ça va\u202f?\u00a0»"
+	result := pipeline.ProcessTextWithOptions(input, pipeline.Options{Lang: transform.LangFrench})
+	if result != expected {
+		t.Errorf("ProcessTextWithOptions(%q, fr)\n  got: %q\n want: %q", input, result, expected)
+	}
+}
+
+func TestProcessCapitalizeSentences(t *testing.T) {
+	input := "hello . i met mr. smith at noon... then left !\nit was \"fine!\" he said\n\nnew paragraph (up, 2) here. ok (low)"
+	expected := "Hello. I met mr. smith at noon... then left!\nIt was \"fine!\" he said\n\nNEW PARAGRAPH here. ok"
+	opts := pipeline.Options{CapitalizeSentences: true}
+	result := pipeline.ProcessTextWithOptions(input, opts)
+	if result != expected {
+		t.Errorf("ProcessTextWithOptions(%q)\n  got: %q\n want: %q", input, result, expected)
+	}
+
+	first := strings.Split(result, "\n\n")[0]
+	if diags := pipeline.VerifyIdempotent(first, opts); len(diags) > 0 {
+		t.Errorf("output %q is not idempotent: %v", first, diags)
+	}
+
+	// an initial after a guillemet does not end the sentence either
+	if got := pipeline.ProcessTextWithOptions("« A.a", opts); got != "«A. a" {
+		t.Errorf("ProcessTextWithOptions(%q) = %q, want %q", "« A.a", got, "«A. a")
+	}
+}
+
+func TestProcessSmartQuotes(t *testing.T) {
+	tests := []struct {
+		lang     transform.Lang
+		input    string
+		expected string
+	}{
+		{transform.LangEnglish, `she said " it's an apple from the '90s " , 'ok'`, "she said “it’s an apple from the ’90s”, ‘ok’"},
+		{transform.LangGerman, `er sagte " ja "`, "er sagte „ja“"},
+		{transform.LangFrench, `il a dit : " oui "`, "il a dit\u00a0: «\u00a0oui\u00a0»"},
+	}
+
+	for _, tt := range tests {
+		opts := pipeline.Options{Lang: tt.lang, SmartQuotes: true}
+		result := pipeline.ProcessTextWithOptions(tt.input, opts)
+		if result != tt.expected {
+			t.Errorf("ProcessTextWithOptions(%q, %s)\n  got: %q\n want: %q", tt.input, tt.lang, result, tt.expected)
+		}
+		if diags := pipeline.VerifyIdempotent(result, opts); len(diags) > 0 {
+			t.Errorf("output %q is not idempotent: %v", result, diags)
+		}
+	}
+}
+
+func TestProcessExtraStages(t *testing.T) {
+	var order []string
+	stage := func(name string) pipeline.Transform {
+		return pipeline.TransformFunc(func(tokens []string) []string {
+			order = append(order, name)
+			return tokens
+		})
+	}
+	reverse := pipeline.TransformFunc(func(tokens []string) []string {
+		for l, r := 0, len(tokens)-1; l < r; l, r = l+1, r-1 {
+			tokens[l], tokens[r] = tokens[r], tokens[l]
+		}
+		return tokens
+	})
+	opts := pipeline.Options{Stages: []pipeline.Stage{
+		{Position: pipeline.AfterMarkers, Transform: stage("after markers")},
+		{Position: pipeline.BeforeNumbers, Transform: stage("before numbers")},
+		{Position: pipeline.AfterArticles, Transform: stage("after articles")},
+		{Position: pipeline.AfterNumbers, Transform: stage("after numbers")},
+		{Position: pipeline.AfterMarkers, Transform: reverse},
+	}}
+
+	result := pipeline.ProcessTextWithOptions("see 1E (hex) now (up) .", opts)
+	if expected := ". NOW 30 see"; result != expected {
+		t.Errorf("ProcessTextWithOptions with stages = %q, want %q", result, expected)
+	}
+	wantOrder := []string{"before numbers", "after numbers", "after articles", "after markers"}
+	if strings.Join(order, ",") != strings.Join(wantOrder, ",") {
+		t.Errorf("stages ran in order %v, want %v", order, wantOrder)
+	}
+}
+
+func TestReloadedRegister(t *testing.T) {
+	reloaded.Register(reloaded.AfterMarkers, reloaded.TransformFunc(func(tokens []string) []string {
+		for i, tok := range tokens {
+			if tok == "go" {
+				tokens[i] = "Go"
+			}
+		}
+		return tokens
+	}))
+	result := reloaded.ProcessText("we write go (cap, 2) in go .")
+	if expected := "we Write Go in Go."; result != expected {
+		t.Errorf("reloaded.ProcessText = %q, want %q", result, expected)
+	}
+}
+
+func TestProcessDiagnostics(t *testing.T) {
+	result := pipeline.Process("fine (see above)\nopen ( here\n(up:start) never closed", pipeline.Options{})
+	var lines []int
+	for _, d := range result.Diagnostics {
+		lines = append(lines, d.Line)
+	}
+	if len(lines) != 2 || lines[0] != 2 || lines[1] != 3 {
+		t.Errorf("Process diagnostics on lines %v, want [2 3]: %v", lines, result.Diagnostics)
+	}
+}
+
+func TestProcessQuotesAcrossLines(t *testing.T) {
+	input := "\" It was late ,\n\n\" and ' very ' dark . \"\nhe said \" what"
+	want := "\"It was late,\n\n\"and 'very' dark.\"\nhe said \"what"
+	result := pipeline.Process(input, pipeline.Options{})
+	if result.Text != want {
+		t.Errorf("Process(%q)\n  got: %q\n want: %q", input, result.Text, want)
+	}
+	if len(result.Diagnostics) != 1 || result.Diagnostics[0].Line != 4 {
+		t.Errorf("Process diagnostics = %v, want one on line 4", result.Diagnostics)
+	}
+
+	// a balanced line later on does not close a stray quote
+	for _, input := range []string{
+		"he wrote \"oops\n\nShe said \"fine\" and left.",
+		"'an unclosed one\n\nHe said, 'hello.'",
+	} {
+		result := pipeline.Process(input, pipeline.Options{})
+		if result.Text != input {
+			t.Errorf("Process(%q)\n  got: %q\n want: %q", input, result.Text, input)
+		}
+		if len(result.Diagnostics) != 1 || result.Diagnostics[0].Line != 1 {
+			t.Errorf("Process(%q) diagnostics = %v, want one on line 1", input, result.Diagnostics)
+		}
+	}
+}
+
+func TestProcessQuoteScope(t *testing.T) {
+	input := "He said \" go now \" (up, quote) , then left (up, 2, quote)"
+	want := "He said \"GO NOW\", then left (up, 2, quote)"
+	if got := pipeline.ProcessText(input); got != want {
+		t.Errorf("ProcessText(%q)\n  got: %q\n want: %q", input, got, want)
+	}
+}
+
+func TestProcessApostrophes(t *testing.T) {
+	input := "the students' books , rock 'n' roll and ' hi ' , goin' home"
+	want := "the students' books, rock 'n' roll and 'hi', goin' home"
+	result := pipeline.Process(input, pipeline.Options{})
+	if result.Text != want {
+		t.Errorf("Process(%q)\n  got: %q\n want: %q", input, result.Text, want)
+	}
+	if len(result.Diagnostics) > 0 {
+		t.Errorf("Process diagnostics = %v, want none", result.Diagnostics)
+	}
+}
+
+func TestProcessLineEndings(t *testing.T) {
+	input := "a apple (up) ,ok\r\nb\r\n\r\nc\rd\n"
+	tests := []struct {
+		lineEnding pipeline.LineEnding
+		expected   string
+	}{
+		{pipeline.KeepLineEndings, "an APPLE, ok\r\nb\r\n\r\nc\rd\n"},
+		{pipeline.LF, "an APPLE, ok\nb\n\nc\nd\n"},
+		{pipeline.CRLF, "an APPLE, ok\r\nb\r\n\r\nc\r\nd\r\n"},
+	}
+	for _, tt := range tests {
+		got := pipeline.ProcessTextWithOptions(input, pipeline.Options{LineEnding: tt.lineEnding})
+		if got != tt.expected {
+			t.Errorf("ProcessTextWithOptions(%q) with %v\n  got: %q\n want: %q", input, tt.lineEnding, got, tt.expected)
+		}
+	}
+
+	for text, want := range map[string]pipeline.LineEnding{
+		"one line":   pipeline.LF,
+		"a\nb\n":     pipeline.LF,
+		"a\r\nb\r\n": pipeline.CRLF,
+		"a\rb":       pipeline.CR,
+		"a\r\nb\nc":  pipeline.MixedLineEndings,
+	} {
+		if got := pipeline.DetectLineEnding(text); got != want {
+			t.Errorf("DetectLineEnding(%q) = %v, want %v", text, got, want)
+		}
+	}
+}
+
+func TestProcessIdempotent(t *testing.T) {
+	for _, input := range []string{
+		"a (up) apple",
+		"00 (cap) (hex)",
+		"1E (hex) (hex)",
+		"2 (bin) (snake, 2)",
+		"word' quoted!'",
+		"0!'A'''A0",
+		"(A\"A000",
+		"it (up, -1) stays",
+		"0\"0(Bin)",
+		"0''0(Bin)",
+		"\"0 \"(Bin)",
+		"A(Bin)(heX)",
+		"' 00 !'",
+		"«a apple»",
+		"«1E (hex)»",
+		"?\"«¿»1E(hex)",
+	} {
+		first := pipeline.ProcessText(input)
+		if diags := pipeline.VerifyIdempotent(first, pipeline.Options{}); len(diags) > 0 {
+			t.Errorf("ProcessText(%q) = %q is not idempotent: %v", input, first, diags)
+		}
+	}
+
+	diags := pipeline.VerifyIdempotent("fine\nnow (up)", pipeline.Options{})
+	if len(diags) != 1 || diags[0].Line != 2 {
+		t.Errorf("VerifyIdempotent diagnostics = %v, want one on line 2", diags)
+	}
+}
+
+// benchDir holds the benchmark corpora: prose.txt is ordinary text with
+// a few markers, markers.txt exercises every marker kind.
+const benchDir = "tests/bench"
+
+func BenchmarkProcessText(b *testing.B) {
+	for _, name := range []string{"prose.txt", "markers.txt"} {
+		data, err := os.ReadFile(filepath.Join(benchDir, name))
+		if err != nil {
+			b.Fatal(err)
+		}
+		// repeat the corpus to get a file of realistic size
+		text := strings.Repeat(string(data), 64)
+
+		b.Run(strings.TrimSuffix(name, ".txt"), func(b *testing.B) {
+			b.SetBytes(int64(len(text)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				pipeline.ProcessText(text)
+			}
+		})
+		b.Run(strings.TrimSuffix(name, ".txt")+"-parallel", func(b *testing.B) {
+			opts := pipeline.Options{Jobs: runtime.GOMAXPROCS(0)}
+			b.SetBytes(int64(len(text)))
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				pipeline.Process(text, opts)
+			}
+		})
+	}
+}
+
+func TestProcessJobs(t *testing.T) {
+	var inputs []string
+	for _, dir := range []string{benchDir, goldenDir} {
+		files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, file := range files {
+			data, err := os.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			inputs = append(inputs, string(data))
+		}
+	}
+	// one document long enough to be split across the workers, with
+	// ranges and diagnostics that cross chunk boundaries
+	text := strings.Join(inputs, "\n")
+	text = strings.Repeat(text+"\n(up:start) open ( here\n", 4) + "done (up:end)"
+
+	want := pipeline.Process(text, pipeline.Options{})
+	for _, jobs := range []int{2, 8} {
+		got := pipeline.Process(text, pipeline.Options{Jobs: jobs})
+		if got.Text != want.Text {
+			t.Errorf("Process with Jobs %d: output differs from the sequential output", jobs)
+		}
+		if !reflect.DeepEqual(got.Diagnostics, want.Diagnostics) {
+			t.Errorf("Process with Jobs %d: diagnostics %v, want %v", jobs, got.Diagnostics, want.Diagnostics)
+		}
+	}
+}
+
+// TestProcessTextAllocs is a regression threshold for the pipeline's
+// allocations per input line on the benchmark corpora, with headroom
+// over the current figures (about 12 for prose and 45 for markers).
+func TestProcessTextAllocs(t *testing.T) {
+	for name, max := range map[string]float64{"prose.txt": 16, "markers.txt": 60} {
+		data, err := os.ReadFile(filepath.Join(benchDir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		text := string(data)
+		lines := float64(strings.Count(text, "\n") + 1)
+		allocs := testing.AllocsPerRun(20, func() {
+			pipeline.ProcessText(text)
+		}) / lines
+		if allocs > max {
+			t.Errorf("ProcessText(%s): %.1f allocations per line, want at most %v", name, allocs, max)
+		}
+	}
+}
+
+// FuzzProcessText checks the pipeline invariants: it never panics, keeps
+// valid UTF-8 valid, is idempotent unless the input escapes or nests
+// parentheses, and for marker-free input (no parentheses) never loses
+// a letter.
+func FuzzProcessText(f *testing.F) {
+	for _, seed := range []string{
+		"it (cap) was the best of times, it was the worst of times (up) !",
+		"She said: ' hello , how are you ? '",
+		"Punctuation tests are ... kinda boring ,what do you think ?",
+		"a honor to meet a hero",
+		"(up:start) multi\nline (up:end) text",
+		"\"double\" and 'single' quotes , mixed",
+		"Line 1\n\n   Line 3",
+		"1E (hex) and 101 (bin)",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		result := pipeline.ProcessText(input)
+		if utf8.ValidString(input) && !utf8.ValidString(result) {
+			t.Fatalf("ProcessText(%q) = %q, not valid UTF-8", input, result)
+		}
+		if !utf8.ValidString(input) || strings.Contains(input, `\`) || nestedParens(input) {
+			return
+		}
+
+		if again := pipeline.ProcessText(result); again != result {
+			t.Fatalf("ProcessText is not idempotent for %q:\n first: %q\nsecond: %q", input, result, again)
+		}
+		// markers are consumed, so only the letters of the rest must remain
+		want := letterCounts(withoutMarkers(input))
+		for r, n := range letterCounts(result) {
+			want[r] -= n
+		}
+		for r, n := range want {
+			if n > 0 {
+				t.Fatalf("ProcessText(%q) = %q, lost letter %q", input, result, r)
+			}
+		}
+	})
+}
+
+// nestedParens reports whether s has parentheses inside parentheses.
+func nestedParens(s string) bool {
+	depth := 0
+	for _, r := range s {
+		switch r {
+		case '(':
+			if depth++; depth > 1 {
+				return true
+			}
+		case ')':
+			if depth > 0 {
+				depth--
+			}
+		}
+	}
+	return false
+}
+
+// withoutMarkers returns the words of s without its markers, and without
+// the hex number before a (hex) marker, whose letters become digits.
+func withoutMarkers(s string) string {
+	var words []string
+	for _, token := range tokenizer.Tokenize(s) {
+		if !transform.IsMarker(token) {
+			words = append(words, token)
+			continue
+		}
+		if m, _ := transform.ParseMarker(token); m.Name == "hex" {
+			for i := len(words) - 1; i >= 0; i-- {
+				if strings.IndexFunc(words[i], unicode.IsLetter) >= 0 {
+					words = append(words[:i], words[i+1:]...)
+					break
+				}
+			}
+		}
+	}
+	return strings.Join(words, " ")
+}
+
+// letterCounts counts how often each letter occurs in s, ignoring case:
+// markers may change it, and ß uppercases to SS.
+func letterCounts(s string) map[rune]int {
+	counts := make(map[rune]int)
+	for _, r := range strings.ToLower(strings.ToUpper(s)) {
+		if unicode.IsLetter(r) {
+			counts[r]++
+		}
+	}
+	return counts
+}
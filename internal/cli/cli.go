@@ -0,0 +1,134 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"go-reloaded/internal/fileio"
+	"go-reloaded/internal/pipeline"
+	"go-reloaded/internal/transform"
+)
+
+// Run is the go-reloaded command line: it parses args (without the
+// program name), reads the input file, applies the pipeline with any
+// extra stages and writes the output file. It returns the exit code.
+func Run(args []string, stages []pipeline.Stage) int {
+	flags := flag.NewFlagSet("go-reloaded", flag.ContinueOnError)
+	flags.SetOutput(io.Discard)
+	lang := flags.String("lang", "", "language rules to apply (en, fr, de, es, el, tr)")
+	countPunct := flags.Bool("count-punctuation", false, "count punctuation tokens as words in case markers")
+	markersFile := flags.String("markers", "", "JSON file defining custom markers")
+	verify := flags.Bool("verify-idempotent", false, "run the pipeline twice and report lines the second pass changes")
+	jobs := flags.Int("jobs", 1, "number of lines to process concurrently")
+	smartQuotes := flags.Bool("smart-quotes", false, "write typographic quotes and apostrophes in the style of --lang")
+	capSentences := flags.Bool("capitalize-sentences", false, "capitalize the first word of each sentence (and \"i\" in English)")
+	encoding := flags.String("encoding", "auto", "encoding of the input file (auto, utf-8, utf-16le, utf-16be, latin1, windows-1252)")
+	lineEndings := flags.String("line-endings", "keep", "line endings of the output (keep, lf, crlf, cr)")
+	outputEncoding := flags.String("output-encoding", "", "encoding of the output file (default: the input's)")
+
+	// validation for correct number arguments
+	if err := flags.Parse(args); err != nil || flags.NArg() != 2 {
+		fmt.Println("Usage: go run . [options] <input.txt> <output.txt>")
+		flags.SetOutput(os.Stdout)
+		flags.PrintDefaults()
+		return 1
+	}
+
+	inputFile := flags.Arg(0)
+	outputFile := flags.Arg(1)
+
+	if *jobs < 1 {
+		fmt.Println("Error in the --jobs option: must be at least 1")
+		return 1
+	}
+
+	opts := pipeline.Options{
+		CountPunctuation:    *countPunct,
+		CapitalizeSentences: *capSentences,
+		SmartQuotes:         *smartQuotes,
+		Stages:              stages,
+		Jobs:                *jobs,
+	}
+	var err error
+	opts.Lang, err = transform.ParseLang(*lang)
+	if err != nil {
+		fmt.Println("Error in the --lang option:", err)
+		return 1
+	}
+	opts.LineEnding, err = pipeline.ParseLineEnding(*lineEndings)
+	if err != nil {
+		fmt.Println("Error in the --line-endings option:", err)
+		return 1
+	}
+
+	inputEnc, err := fileio.ParseEncoding(*encoding)
+	if err != nil {
+		fmt.Println("Error in the --encoding option:", err)
+		return 1
+	}
+	outputEnc, err := fileio.ParseEncoding(*outputEncoding)
+	if err != nil {
+		fmt.Println("Error in the --output-encoding option:", err)
+		return 1
+	}
+
+	if *markersFile != "" {
+		config, err := fileio.ReadInputFile(*markersFile)
+		if err != nil {
+			fmt.Println("Error in reading the markers file:", err)
+			return 1
+		}
+		opts.CustomMarkers, err = transform.ParseCustomMarkers([]byte(config))
+		if err != nil {
+			fmt.Println("Error in the markers file:", err)
+			return 1
+		}
+	}
+
+	input, err := fileio.ReadInput(inputFile, inputEnc)
+	if err != nil {
+		fmt.Println("Error in reading the input file:", err)
+		return 1
+	}
+
+	result := pipeline.Process(input.Text, opts)
+	// diagnostics are warnings: the output is still written
+	for _, d := range input.Diagnostics {
+		fmt.Fprintln(os.Stderr, "Warning:", d)
+	}
+	if opts.LineEnding == pipeline.KeepLineEndings && pipeline.DetectLineEnding(input.Text) == pipeline.MixedLineEndings {
+		fmt.Fprintln(os.Stderr, "Warning: the input mixes line endings; they are kept as they are (see --line-endings)")
+	}
+	for _, d := range result.Diagnostics {
+		fmt.Fprintln(os.Stderr, "Warning:", d)
+	}
+
+	// the output is written the way the input was, unless asked otherwise
+	bom := input.BOM
+	if outputEnc == fileio.Auto {
+		outputEnc = input.Encoding
+	} else if outputEnc != input.Encoding {
+		bom = outputEnc == fileio.UTF16LE || outputEnc == fileio.UTF16BE
+	}
+	unwritable, err := fileio.WriteOutput(outputFile, result.Text, outputEnc, bom)
+	if err != nil {
+		fmt.Println("Error in writing the output file:", err)
+		return 1
+	}
+	for _, d := range unwritable {
+		fmt.Fprintln(os.Stderr, "Warning:", d)
+	}
+
+	if *verify {
+		unstable := pipeline.VerifyIdempotent(result.Text, opts)
+		for _, d := range unstable {
+			fmt.Fprintln(os.Stderr, "Not idempotent:", d)
+		}
+		if len(unstable) > 0 {
+			return 1
+		}
+	}
+	return 0
+}
@@ -0,0 +1,20 @@
+package diag
+
+import "fmt"
+
+// Diagnostic describes a problem found in the input that did not stop
+// processing, such as an unclosed range marker. The affected text is
+// left as it was so the user can fix it by hand.
+type Diagnostic struct {
+	// Line is the 1-based input line, or 0 when it is not known.
+	Line    int
+	Message string
+}
+
+// String formats the diagnostic as "line N: message".
+func (d Diagnostic) String() string {
+	if d.Line == 0 {
+		return d.Message
+	}
+	return fmt.Sprintf("line %d: %s", d.Line, d.Message)
+}
@@ -0,0 +1,341 @@
+package fileio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+
+	"go-reloaded/internal/diag"
+)
+
+// Encoding is a text encoding of the input and output files. The text
+// itself is always processed as UTF-8.
+type Encoding int
+
+const (
+	// Auto detects the encoding of the input, see DetectEncoding.
+	Auto Encoding = iota
+	UTF8
+	UTF16LE
+	UTF16BE
+	// Latin1 is ISO-8859-1: every byte is the code point of the same value.
+	Latin1
+	// Windows1252 is Latin1 with typographic marks like “ ” … and € in
+	// place of the control codes 0x80 to 0x9F.
+	Windows1252
+)
+
+// encodingNames maps the names accepted by ParseEncoding to encodings.
+// The first name of each encoding is the one String returns.
+var encodingNames = []struct {
+	name string
+	enc  Encoding
+}{
+	{"auto", Auto},
+	{"utf-8", UTF8}, {"utf8", UTF8},
+	{"utf-16le", UTF16LE}, {"utf16le", UTF16LE},
+	{"utf-16be", UTF16BE}, {"utf16be", UTF16BE},
+	{"latin-1", Latin1}, {"latin1", Latin1}, {"iso-8859-1", Latin1},
+	{"windows-1252", Windows1252}, {"cp1252", Windows1252},
+}
+
+// String returns the name of the encoding, e.g. "utf-16le".
+func (e Encoding) String() string {
+	for _, n := range encodingNames {
+		if n.enc == e {
+			return n.name
+		}
+	}
+	return fmt.Sprintf("Encoding(%d)", int(e))
+}
+
+// ParseEncoding parses an encoding name such as "utf-8", "utf-16le",
+// "latin1" or "windows-1252", in any case. The empty string means Auto.
+func ParseEncoding(name string) (Encoding, error) {
+	if name == "" {
+		return Auto, nil
+	}
+	for _, n := range encodingNames {
+		if strings.EqualFold(name, n.name) {
+			return n.enc, nil
+		}
+	}
+	return Auto, fmt.Errorf("unknown encoding %q (want utf-8, utf-16le, utf-16be, latin1 or windows-1252)", name)
+}
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// bomFor returns the byte order mark of the encoding, or nil when it has
+// none.
+func bomFor(enc Encoding) []byte {
+	switch enc {
+	case UTF8:
+		return bomUTF8
+	case UTF16LE:
+		return bomUTF16LE
+	case UTF16BE:
+		return bomUTF16BE
+	}
+	return nil
+}
+
+// DetectEncoding guesses the encoding of data and reports whether it
+// starts with a byte order mark:
+//  1. a byte order mark gives UTF-8, UTF-16LE or UTF-16BE
+//  2. zero bytes in every other position mean UTF-16 without a mark,
+//     since text files have no zero bytes otherwise
+//  3. valid UTF-8 is UTF-8, and so is UTF-8 with a few broken bytes
+//     (see Decode for how those are reported)
+//  4. anything else is Windows-1252, the usual encoding of files exported
+//     from older Windows programs
+func DetectEncoding(data []byte) (enc Encoding, bom bool) {
+	switch {
+	case bytes.HasPrefix(data, bomUTF8):
+		return UTF8, true
+	case bytes.HasPrefix(data, bomUTF16LE):
+		return UTF16LE, true
+	case bytes.HasPrefix(data, bomUTF16BE):
+		return UTF16BE, true
+	}
+	if enc, ok := detectUTF16(data); ok {
+		return enc, false
+	}
+	if utf8.Valid(data) || hasMultiByteUTF8(data) {
+		return UTF8, false
+	}
+	return Windows1252, false
+}
+
+// detectUTF16 recognizes UTF-16 without a byte order mark by its zero
+// bytes: the high bytes of ASCII characters.
+func detectUTF16(data []byte) (Encoding, bool) {
+	if len(data) < 2 || len(data)%2 != 0 {
+		return Auto, false
+	}
+	sample := data[:min(len(data), 1024)]
+	var even, odd int
+	for i, b := range sample {
+		if b == 0 && i%2 == 0 {
+			even++
+		} else if b == 0 {
+			odd++
+		}
+	}
+	pairs := len(sample) / 2
+	switch {
+	case odd*2 >= pairs && even == 0:
+		return UTF16LE, true
+	case even*2 >= pairs && odd == 0:
+		return UTF16BE, true
+	}
+	return Auto, false
+}
+
+// hasMultiByteUTF8 reports whether data holds a valid UTF-8 sequence of
+// more than one byte, which single-byte encodings almost never produce.
+func hasMultiByteUTF8(data []byte) bool {
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r != utf8.RuneError && size > 1 {
+			return true
+		}
+		data = data[size:]
+	}
+	return false
+}
+
+// Decode converts data in the given encoding to UTF-8 text, without the
+// byte order mark if there is one. Bytes that are not valid in the
+// encoding, like broken UTF-8 sequences or unpaired UTF-16 surrogates,
+// are replaced with U+FFFD and reported with their line.
+func Decode(data []byte, enc Encoding) (string, []diag.Diagnostic) {
+	if enc == Auto {
+		enc, _ = DetectEncoding(data)
+	}
+	data = bytes.TrimPrefix(data, bomFor(enc))
+
+	switch enc {
+	case UTF16LE, UTF16BE:
+		return decodeUTF16(data, enc)
+	case Latin1:
+		var b strings.Builder
+		b.Grow(len(data) + len(data)/8)
+		for _, c := range data {
+			b.WriteRune(rune(c))
+		}
+		return b.String(), nil
+	case Windows1252:
+		var b strings.Builder
+		b.Grow(len(data) + len(data)/8)
+		for _, c := range data {
+			b.WriteRune(windows1252Rune(c))
+		}
+		return b.String(), nil
+	}
+	return decodeUTF8(data)
+}
+
+// decodeUTF8 returns data as text, replacing invalid bytes.
+func decodeUTF8(data []byte) (string, []diag.Diagnostic) {
+	if utf8.Valid(data) {
+		return string(data), nil
+	}
+	var b strings.Builder
+	var diags []diag.Diagnostic
+	b.Grow(len(data))
+	line, reported := 1, 0
+	for len(data) > 0 {
+		r, size := utf8.DecodeRune(data)
+		if r == utf8.RuneError && size == 1 {
+			// one diagnostic per line is enough to find the bytes
+			if reported != line {
+				diags = append(diags, diag.Diagnostic{
+					Line:    line,
+					Message: fmt.Sprintf("invalid UTF-8 byte 0x%02X replaced with U+FFFD", data[0]),
+				})
+				reported = line
+			}
+		} else if r == '\n' {
+			line++
+		}
+		b.WriteRune(r)
+		data = data[size:]
+	}
+	return b.String(), diags
+}
+
+// decodeUTF16 returns data as text, replacing unpaired surrogates and an
+// odd final byte.
+func decodeUTF16(data []byte, enc Encoding) (string, []diag.Diagnostic) {
+	order := binary.ByteOrder(binary.LittleEndian)
+	if enc == UTF16BE {
+		order = binary.BigEndian
+	}
+	var b strings.Builder
+	var diags []diag.Diagnostic
+	b.Grow(len(data) / 2)
+	line, reported := 1, 0
+	invalid := func(what string) {
+		b.WriteRune(utf8.RuneError)
+		if reported != line {
+			diags = append(diags, diag.Diagnostic{
+				Line:    line,
+				Message: fmt.Sprintf("invalid %s %s replaced with U+FFFD", enc, what),
+			})
+			reported = line
+		}
+	}
+
+	for i := 0; i+1 < len(data); i += 2 {
+		u := order.Uint16(data[i:])
+		switch {
+		case utf16.IsSurrogate(rune(u)):
+			if i+3 < len(data) {
+				if r := utf16.DecodeRune(rune(u), rune(order.Uint16(data[i+2:]))); r != utf8.RuneError {
+					b.WriteRune(r)
+					i += 2
+					continue
+				}
+			}
+			invalid("surrogate")
+		default:
+			if u == '\n' {
+				line++
+			}
+			b.WriteRune(rune(u))
+		}
+	}
+	if len(data)%2 != 0 {
+		invalid("final byte")
+	}
+	return b.String(), diags
+}
+
+// Encode converts UTF-8 text to the given encoding, with a byte order
+// mark if bom is set and the encoding has one. Auto means UTF-8. Runes
+// the encoding cannot represent, like Greek letters in Windows-1252, are
+// written as "?" and reported with their line.
+func Encode(text string, enc Encoding, bom bool) ([]byte, []diag.Diagnostic) {
+	var out []byte
+	if bom {
+		out = append(out, bomFor(enc)...)
+	}
+
+	switch enc {
+	case UTF16LE, UTF16BE:
+		var order binary.AppendByteOrder = binary.LittleEndian
+		if enc == UTF16BE {
+			order = binary.BigEndian
+		}
+		out = slices.Grow(out, 2*len(text))
+		for _, u := range utf16.Encode([]rune(text)) {
+			out = order.AppendUint16(out, u)
+		}
+		return out, nil
+	case Latin1, Windows1252:
+		var diags []diag.Diagnostic
+		out = slices.Grow(out, len(text))
+		line, reported := 1, 0
+		for _, r := range text {
+			c, ok := encodeSingleByte(r, enc)
+			if !ok && reported != line {
+				diags = append(diags, diag.Diagnostic{
+					Line:    line,
+					Message: fmt.Sprintf("%q cannot be written in %s, wrote \"?\"", r, enc),
+				})
+				reported = line
+			}
+			if r == '\n' {
+				line++
+			}
+			out = append(out, c)
+		}
+		return out, diags
+	}
+	return append(out, text...), nil
+}
+
+// encodeSingleByte returns the Latin-1 or Windows-1252 byte for r, or
+// "?" and false when there is none.
+func encodeSingleByte(r rune, enc Encoding) (byte, bool) {
+	if enc == Windows1252 && r >= 0x80 {
+		for i, w := range windows1252 {
+			if w == r {
+				return byte(0x80 + i), true
+			}
+		}
+		if r <= 0x9F && windows1252[r-0x80] != 0 {
+			// a control code whose byte Windows-1252 uses for a mark
+			return '?', false
+		}
+	}
+	if r < 0x100 {
+		return byte(r), true
+	}
+	return '?', false
+}
+
+// windows1252 holds the runes of the bytes 0x80 to 0x9F in Windows-1252;
+// 0 marks the five bytes it leaves undefined.
+var windows1252 = [32]rune{
+	'€', 0, '‚', 'ƒ', '„', '…', '†', '‡', 'ˆ', '‰', 'Š', '‹', 'Œ', 0, 'Ž', 0,
+	0, '‘', '’', '“', '”', '•', '–', '—', '˜', '™', 'š', '›', 'œ', 0, 'ž', 'Ÿ',
+}
+
+// windows1252Rune decodes one Windows-1252 byte. The undefined bytes
+// decode to the control code of the same value, as in Latin-1, so they
+// are written back unchanged.
+func windows1252Rune(c byte) rune {
+	if c >= 0x80 && c <= 0x9F && windows1252[c-0x80] != 0 {
+		return windows1252[c-0x80]
+	}
+	return rune(c)
+}
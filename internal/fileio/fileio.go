@@ -1,21 +1,56 @@
 package fileio
 
-import "os"
+import (
+	"os"
 
-// ReadInputFile opens the given file and returns its content as a string.
-func ReadInputFile(path string) (string, error) {
+	"go-reloaded/internal/diag"
+)
+
+// Input is a decoded input file.
+type Input struct {
+	Text string
+	// Encoding is the encoding the file was read in, as given or detected,
+	// and BOM whether it started with a byte order mark. Passing both to
+	// WriteOutput writes the output the same way.
+	Encoding Encoding
+	BOM      bool
+	// Diagnostics report bytes that are not valid in the encoding.
+	Diagnostics []diag.Diagnostic
+}
+
+// ReadInput reads the file at path and decodes it from enc, or from the
+// encoding DetectEncoding finds when enc is Auto.
+func ReadInput(path string, enc Encoding) (Input, error) {
 	data, err := os.ReadFile(path)
 	if err != nil {
-		return "", err
+		return Input{}, err
+	}
+	detected, bom := DetectEncoding(data)
+	if enc == Auto {
+		enc = detected
+	} else {
+		bom = bom && detected == enc
 	}
-	return string(data), nil // convert []byte to string and return it
+	text, diags := Decode(data, enc)
+	return Input{Text: text, Encoding: enc, BOM: bom, Diagnostics: diags}, nil
+}
+
+// ReadInputFile opens the given file and returns its content as a string,
+// decoded from the encoding DetectEncoding finds.
+func ReadInputFile(path string) (string, error) {
+	in, err := ReadInput(path, Auto)
+	return in.Text, err
+}
+
+// WriteOutput writes content to the file at path in the given encoding,
+// see Encode. The diagnostics report runes the encoding cannot represent.
+func WriteOutput(path, content string, enc Encoding, bom bool) ([]diag.Diagnostic, error) {
+	data, diags := Encode(content, enc, bom)
+	return diags, os.WriteFile(path, data, 0o644)
 }
 
 // WriteOutputFile writes the transformed content after all transformation rules applied into a file at the given path.
 func WriteOutputFile(path, content string) error {
-	err := os.WriteFile(path, []byte(content), 0o644)
-	if err != nil {
-		return err
-	}
-	return nil
+	_, err := WriteOutput(path, content, UTF8, false)
+	return err
 }
@@ -0,0 +1,118 @@
+package fileio
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestDetectEncoding(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		enc  Encoding
+		bom  bool
+	}{
+		{"ascii", []byte("hello"), UTF8, false},
+		{"utf-8", []byte("café"), UTF8, false},
+		{"utf-8 with bom", []byte("\xEF\xBB\xBFhi"), UTF8, true},
+		{"utf-16le with bom", []byte("\xFF\xFEh\x00i\x00"), UTF16LE, true},
+		{"utf-16be with bom", []byte("\xFE\xFF\x00h\x00i"), UTF16BE, true},
+		{"utf-16le without bom", []byte("h\x00i\x00"), UTF16LE, false},
+		{"windows-1252", []byte("caf\xE9 \x93ok\x94"), Windows1252, false},
+		{"broken utf-8", []byte("café \xFF"), UTF8, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			enc, bom := DetectEncoding(tt.data)
+			if enc != tt.enc || bom != tt.bom {
+				t.Errorf("DetectEncoding(%q) = %v, %v, want %v, %v", tt.data, enc, bom, tt.enc, tt.bom)
+			}
+		})
+	}
+}
+
+func TestDecode(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		enc      Encoding
+		expected string
+		diags    int
+	}{
+		{"utf-8 bom removed", []byte("\xEF\xBB\xBFhi"), Auto, "hi", 0},
+		{"utf-16le", []byte("\xFF\xFEh\x00\xE9\x00"), Auto, "hé", 0},
+		{"utf-16be surrogate pair", []byte("\xFE\xFF\xD8\x3D\xDE\x00"), Auto, "😀", 0},
+		{"unpaired surrogate", []byte("\xFF\xFE\x3D\xD8a\x00"), Auto, "�a", 1},
+		{"latin1", []byte("caf\xE9 \x93"), Latin1, "café \u0093", 0},
+		{"windows-1252", []byte("caf\xE9 \x93ok\x94 \x80"), Auto, "café “ok” €", 0},
+		{"invalid utf-8 reported per line", []byte("ok é\n\xFF\xFE\n\xC3"), UTF8, "ok é\n��\n�", 2},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			text, diags := Decode(tt.data, tt.enc)
+			if text != tt.expected || len(diags) != tt.diags {
+				t.Errorf("Decode(%q, %v) = %q with %v, want %q with %d diagnostics",
+					tt.data, tt.enc, text, diags, tt.expected, tt.diags)
+			}
+		})
+	}
+}
+
+func TestEncodeUnwritable(t *testing.T) {
+	data, diags := Encode("“ok” €\nΑθήνα", Windows1252, false)
+	if want := []byte("\x93ok\x94 \x80\n?????"); !bytes.Equal(data, want) {
+		t.Errorf("Encode = %q, want %q", data, want)
+	}
+	if len(diags) != 1 || diags[0].Line != 2 {
+		t.Errorf("Encode diagnostics = %v, want one on line 2", diags)
+	}
+}
+
+// TestRoundTrip checks that a file read and written back in the encoding
+// it was read in comes out byte for byte the same.
+func TestRoundTrip(t *testing.T) {
+	for _, data := range [][]byte{
+		[]byte("plain\n"),
+		[]byte("\xEF\xBB\xBFcafé\n"),
+		[]byte("\xFF\xFEh\x00\xE9\x00\n\x00"),
+		[]byte("\xFE\xFF\x00h\x00\xE9"),
+		[]byte("caf\xE9 \x93ok\x94 \x81"),
+	} {
+		dir := t.TempDir()
+		in, out := filepath.Join(dir, "in.txt"), filepath.Join(dir, "out.txt")
+		if err := os.WriteFile(in, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		input, err := ReadInput(in, Auto)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := WriteOutput(out, input.Text, input.Encoding, input.BOM); err != nil {
+			t.Fatal(err)
+		}
+		got, err := os.ReadFile(out)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, data) {
+			t.Errorf("round trip of %q as %v gave %q", data, input.Encoding, got)
+		}
+	}
+}
+
+func TestParseEncoding(t *testing.T) {
+	for name, want := range map[string]Encoding{
+		"": Auto, "UTF-8": UTF8, "utf-16le": UTF16LE, "Latin1": Latin1, "cp1252": Windows1252,
+	} {
+		if got, err := ParseEncoding(name); err != nil || got != want {
+			t.Errorf("ParseEncoding(%q) = %v, %v, want %v", name, got, err, want)
+		}
+	}
+	if _, err := ParseEncoding("ebcdic"); err == nil {
+		t.Error("ParseEncoding(\"ebcdic\") gave no error")
+	}
+}
@@ -0,0 +1,136 @@
+package pipeline
+
+import (
+	"fmt"
+	"strings"
+)
+
+// LineEnding is a line ending convention.
+type LineEnding int
+
+const (
+	// KeepLineEndings writes every line with the line ending it had in
+	// the input.
+	KeepLineEndings LineEnding = iota
+	LF
+	CRLF
+	CR
+	// MixedLineEndings is what DetectLineEnding reports for text that
+	// uses more than one convention. ParseLineEnding does not accept it;
+	// set as Options.LineEnding it means the same as KeepLineEndings.
+	MixedLineEndings
+)
+
+// lineEndingNames are the names ParseLineEnding accepts.
+var lineEndingNames = map[string]LineEnding{
+	"keep": KeepLineEndings, "lf": LF, "crlf": CRLF, "cr": CR,
+}
+
+// ParseLineEnding parses a line ending option: "keep", "lf", "crlf" or
+// "cr", in any case. The empty string means KeepLineEndings.
+func ParseLineEnding(name string) (LineEnding, error) {
+	if name == "" {
+		return KeepLineEndings, nil
+	}
+	if le, ok := lineEndingNames[strings.ToLower(name)]; ok {
+		return le, nil
+	}
+	return KeepLineEndings, fmt.Errorf("unknown line ending %q (want keep, lf, crlf or cr)", name)
+}
+
+// String returns the name of the convention, e.g. "crlf".
+func (le LineEnding) String() string {
+	switch le {
+	case KeepLineEndings:
+		return "keep"
+	case LF:
+		return "lf"
+	case CRLF:
+		return "crlf"
+	case CR:
+		return "cr"
+	case MixedLineEndings:
+		return "mixed"
+	}
+	return fmt.Sprintf("LineEnding(%d)", int(le))
+}
+
+// sequence returns the characters that end a line in the convention, or
+// "" for KeepLineEndings and MixedLineEndings.
+func (le LineEnding) sequence() string {
+	switch le {
+	case LF:
+		return "\n"
+	case CRLF:
+		return "\r\n"
+	case CR:
+		return "\r"
+	}
+	return ""
+}
+
+// DetectLineEnding reports the line ending convention of text: LF, CRLF,
+// CR or MixedLineEndings. Text without line breaks counts as LF.
+func DetectLineEnding(text string) LineEnding {
+	_, endings := splitLines(text)
+	found, seen := LF, false
+	for _, ending := range endings {
+		le := LF
+		switch ending {
+		case "":
+			continue
+		case "\r\n":
+			le = CRLF
+		case "\r":
+			le = CR
+		}
+		if seen && le != found {
+			return MixedLineEndings
+		}
+		found, seen = le, true
+	}
+	return found
+}
+
+// splitLines splits text into lines at "\n", "\r\n" and a lone "\r".
+// endings[i] holds the characters that ended lines[i]; the last one is
+// always "", so joining the lines with their endings gives back text.
+func splitLines(text string) (lines, endings []string) {
+	n := strings.Count(text, "\n") + 1
+	lines = make([]string, 0, n)
+	endings = make([]string, 0, n)
+	for {
+		i := strings.IndexAny(text, "\r\n")
+		if i < 0 {
+			return append(lines, text), append(endings, "")
+		}
+		size := 1
+		if text[i] == '\r' && i+1 < len(text) && text[i+1] == '\n' {
+			size = 2
+		}
+		lines = append(lines, text[:i])
+		endings = append(endings, text[i:i+size])
+		text = text[i+size:]
+	}
+}
+
+// joinLines is the reverse of splitLines. Unless le is KeepLineEndings or
+// MixedLineEndings, every line ending is written in the convention le.
+func joinLines(lines, endings []string, le LineEnding) string {
+	seq := le.sequence()
+	size := 0
+	for i := range lines {
+		size += len(lines[i]) + len(endings[i])
+	}
+	var b strings.Builder
+	b.Grow(size)
+	for i, line := range lines {
+		b.WriteString(line)
+		if seq != "" && endings[i] != "" {
+			b.WriteString(seq)
+		} else {
+			b.WriteString(endings[i])
+		}
+	}
+	return b.String()
+}
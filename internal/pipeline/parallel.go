@@ -0,0 +1,40 @@
+package pipeline
+
+import "sync"
+
+// linesPerChunk is how many consecutive lines a worker takes at a time,
+// so that short lines do not cost a channel operation each.
+const linesPerChunk = 64
+
+// forEachLine calls fn for every line index in [0, n). With jobs > 1 the
+// lines are split into chunks handled by a pool of jobs workers; fn must
+// then only touch the data of its own line. It returns when all lines
+// are done.
+func forEachLine(n, jobs int, fn func(i int)) {
+	if jobs <= 1 || n <= linesPerChunk {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+
+	chunks := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < jobs; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for start := range chunks {
+				end := min(start+linesPerChunk, n)
+				for i := start; i < end; i++ {
+					fn(i)
+				}
+			}
+		}()
+	}
+	for start := 0; start < n; start += linesPerChunk {
+		chunks <- start
+	}
+	close(chunks)
+	wg.Wait()
+}
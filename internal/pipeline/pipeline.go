@@ -1,37 +1,262 @@
 package pipeline
 
 import (
+	"fmt"
+	"sort"
 	"strings"
+	"unicode"
+	"unicode/utf8"
 
+	"go-reloaded/internal/diag"
 	"go-reloaded/internal/tokenizer"
 	"go-reloaded/internal/transform"
 )
 
+// Options configures optional pipeline behavior.
+// The zero value matches ProcessText.
+type Options struct {
+	// Lang selects language-specific rules, e.g. Turkish or Greek casing
+	// and French punctuation spacing (see transform.SpacingFor).
+	Lang transform.Lang
+	// CountPunctuation makes case marker counts include punctuation
+	// tokens, matching the behavior of earlier versions.
+	CountPunctuation bool
+	// CustomMarkers holds project-specific markers loaded from a config
+	// file (see transform.ParseCustomMarkers).
+	CustomMarkers transform.CustomMarkers
+	// Punctuation sets how punctuation marks are split and spaced.
+	// Nil means the classes of the Lang spacing profile.
+	Punctuation transform.PunctuationClasses
+	// CapitalizeSentences capitalizes the first word of every sentence,
+	// and for English the pronoun "i" (see transform.CapitalizeSentences).
+	// Case markers are applied afterwards, so they win, though a second
+	// run capitalizes a sentence-initial word that (low) kept lowercase.
+	CapitalizeSentences bool
+	// SmartQuotes writes typographic quotes and apostrophes, “like this”,
+	// in the style of Lang (see transform.SmartQuotes). Typographic quotes
+	// in the input are read as straight ones first.
+	SmartQuotes bool
+	// Stages holds extra transforms to run at defined positions in the
+	// pipeline, in addition to the standard stages.
+	Stages []Stage
+	// LineEnding writes every line ending in the given convention. The
+	// zero value, KeepLineEndings, keeps the line endings of the input,
+	// even when they are mixed.
+	LineEnding LineEnding
+	// Jobs is the number of lines processed concurrently. Zero or one
+	// processes them one after another. The output is the same either
+	// way, but with Jobs > 1 extra stages must be safe for concurrent use.
+	Jobs int
+}
+
+// Result is the output of Process: the transformed text together with
+// any problems found in the input along the way.
+type Result struct {
+	Text        string
+	Diagnostics []diag.Diagnostic
+}
+
 // ProcessText is the main text-processing pipeline.
 // It processes text line-by-line to preserve newlines while applying
 // all transformation stages in the correct order.
 func ProcessText(text string) string {
-	// Preserve newlines by processing line-by-line
-	lines := strings.Split(text, "\n")
-	output := make([]string, 0, len(lines))
+	return ProcessTextWithOptions(text, Options{})
+}
+
+// ProcessTextWithOptions is ProcessText with configurable behavior.
+func ProcessTextWithOptions(text string, opts Options) string {
+	return Process(text, opts).Text
+}
+
+// Process runs the pipeline and also returns diagnostics.
+//
+// Most stages work on one line at a time, on opts.Jobs lines at once.
+// Range markers such as (up:start) ... (up:end) may span lines, so they
+// are applied to the whole document between the per-line token stages.
+// Quotations may span lines too: their quotes are paired over the whole
+// document before the per-line quote stages.
+//
+// Line endings, including the one at the end of the text or its absence,
+// are kept (see Options.LineEnding), and so are the indentation and the
+// trailing whitespace of every line and whitespace-only lines.
+//
+// Processing is idempotent: running the pipeline on its own output
+// changes nothing. The exceptions are escaped parentheses, since \(up)
+// is written out as (up), and parentheses that read as a marker once the
+// markers inside them are applied, like (hex (up)), which becomes (HEX).
+func Process(text string, opts Options) Result {
+	// Preserve newlines by processing line-by-line; lines are processed
+	// without their line endings, which are put back at the end
+	lines, endings := splitLines(text)
+	caseOpts := transform.CaseOptions{
+		Lang:             opts.Lang,
+		CountPunctuation: opts.CountPunctuation,
+		CustomMarkers:    opts.CustomMarkers,
+	}
 
-	for _, line := range lines {
+	spacing := transform.SpacingFor(opts.Lang)
+	if opts.Punctuation != nil {
+		spacing.Punctuation = opts.Punctuation
+	}
+
+	tokOpts := tokenizer.Options{
+		IsMarker: func(token string) bool {
+			return transform.IsMarker(token) || opts.CustomMarkers.IsMarker(token)
+		},
+		Punctuation: spacing.Punctuation,
+	}
+
+	tokenLines := make([][]string, len(lines))
+	lineDiags := make([][]diag.Diagnostic, len(lines))
+	// indentation and trailing whitespace are put back as they were too
+	indents := make([]string, len(lines))
+	trailing := make([]string, len(lines))
+	forEachLine(len(lines), opts.Jobs, func(i int) {
+		line := lines[i]
 		if line == "" {
-			output = append(output, "")
-			continue
+			return
+		}
+		if opts.SmartQuotes {
+			// before the whitespace is split off: a guillemet takes the
+			// space next to it along
+			line = transform.StraightenQuotes(line, spacing)
+		}
+		indents[i], line, trailing[i] = splitSpace(line)
+		if line == "" {
+			return
 		}
 		// Tokenize and apply token-level transforms
-		words := tokenizer.Tokenize(line)
-		words = transform.ConvertHexAndBin(words)
+		words, tokDiags := tokenizer.TokenizeWithOptions(line, tokOpts)
+		for j := range tokDiags {
+			tokDiags[j].Line = i + 1
+		}
+		lineDiags[i] = tokDiags
+		words = runStages(opts.Stages, BeforeNumbers, words)
+		words = transform.ConvertHexAndBinWithMarkers(words, opts.CustomMarkers)
+		words = runStages(opts.Stages, AfterNumbers, words)
 		words = transform.FixArticles(words)
-		words = transform.ApplyCaseRules(words)
+		words = runStages(opts.Stages, AfterArticles, words)
+		tokenLines[i] = words
+	})
+
+	var diags []diag.Diagnostic
+	for _, d := range lineDiags {
+		diags = append(diags, d...)
+	}
+	if opts.CapitalizeSentences {
+		// sentences may span lines, so this needs the whole document
+		tokenLines = transform.CapitalizeSentencesWithOptions(tokenLines, caseOpts)
+	}
+	tokenLines, rangeDiags := transform.ApplyRangeMarkers(tokenLines, caseOpts)
+	diags = append(diags, rangeDiags...)
+
+	output := make([]string, len(lines))
+	forEachLine(len(lines), opts.Jobs, func(i int) {
+		words := tokenLines[i]
+		if len(words) == 0 {
+			return
+		}
+		words = transform.ApplyCaseRulesWithOptions(words, caseOpts)
+		words = runStages(opts.Stages, AfterMarkers, words)
 
 		// Rebuild the line
 		rebuiltLine := strings.Join(words, " ")
-		// Final spacing and quotes per line
-		rebuiltLine = transform.ApplyPunctuationRules(rebuiltLine)
-		rebuiltLine = transform.FixQuotes(rebuiltLine)
-		output = append(output, rebuiltLine)
+		output[i] = transform.ApplyPunctuationRulesWithProfile(rebuiltLine, spacing)
+	})
+
+	// Quotations may span lines, so pair the quotes of the whole document
+	quoteStates, quoteDiags := transform.MatchQuotes(output, spacing)
+	diags = append(diags, quoteDiags...)
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Line < diags[j].Line })
+
+	forEachLine(len(lines), opts.Jobs, func(i int) {
+		rebuiltLine := output[i]
+		if rebuiltLine == "" {
+			return
+		}
+		// Final quote spacing per line
+		rebuiltLine = transform.FixQuotesWithState(rebuiltLine, spacing, quoteStates[i])
+		// Quote spacing can split a word in two, as in 'a'apple; check the
+		// articles again so a second run has nothing left to change
+		rebuiltLine = fixArticlesInLine(rebuiltLine, tokOpts)
+		if opts.SmartQuotes {
+			rebuiltLine = transform.SmartQuotesWithState(rebuiltLine, spacing, quoteStates[i])
+		}
+		// Escaped parentheses are kept as literal text
+		rebuiltLine = transform.Unescape(rebuiltLine)
+		output[i] = rebuiltLine
+	})
+	for i := range output {
+		if indents[i] != "" || trailing[i] != "" {
+			output[i] = indents[i] + output[i] + trailing[i]
+		}
+	}
+	return Result{Text: joinLines(output, endings, opts.LineEnding), Diagnostics: diags}
+}
+
+// splitSpace splits line into its leading whitespace, the content and its
+// trailing whitespace. A whitespace-only line is all indentation.
+func splitSpace(line string) (indent, content, trailing string) {
+	content = strings.TrimLeftFunc(line, unicode.IsSpace)
+	indent = line[:len(line)-len(content)]
+	trimmed := strings.TrimRightFunc(content, unicode.IsSpace)
+	return indent, trimmed, content[len(trimmed):]
+}
+
+// VerifyIdempotent runs the pipeline a second time over output, the
+// result of processing some text with the same opts, and reports every
+// line the second run would change.
+func VerifyIdempotent(output string, opts Options) []diag.Diagnostic {
+	again, _ := splitLines(Process(output, opts).Text)
+	lines, _ := splitLines(output)
+	var diags []diag.Diagnostic
+	for i, line := range lines {
+		if i < len(again) && again[i] != line {
+			diags = append(diags, diag.Diagnostic{
+				Line:    i + 1,
+				Message: fmt.Sprintf("second pass changes %q to %q", line, again[i]),
+			})
+		}
+	}
+	return diags
+}
+
+// fixArticlesInLine runs FixArticles over the tokens of a finished line
+// and writes any changed article back in place, keeping the spacing.
+func fixArticlesInLine(line string, tokOpts tokenizer.Options) string {
+	if !hasArticle(line) {
+		return line
+	}
+	tokens, _ := tokenizer.TokenizeWithOptions(line, tokOpts)
+	fixed := transform.FixArticles(append([]string(nil), tokens...))
+
+	var b strings.Builder
+	rest := line
+	for i, token := range tokens {
+		at := strings.Index(rest, token)
+		if at < 0 {
+			return line
+		}
+		b.WriteString(rest[:at])
+		b.WriteString(fixed[i])
+		rest = rest[at+len(token):]
+	}
+	b.WriteString(rest)
+	return b.String()
+}
+
+// hasArticle reports whether line may contain the article "a": a lone
+// a or A that is not part of a longer word.
+func hasArticle(line string) bool {
+	for i := 0; i < len(line); i++ {
+		if line[i] != 'a' && line[i] != 'A' {
+			continue
+		}
+		before, _ := utf8.DecodeLastRuneInString(line[:i])
+		after, _ := utf8.DecodeRuneInString(line[i+1:])
+		if !unicode.IsLetter(before) && !unicode.IsLetter(after) {
+			return true
+		}
 	}
-	return strings.Join(output, "\n")
+	return false
 }
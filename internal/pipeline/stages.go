@@ -0,0 +1,49 @@
+package pipeline
+
+// Transform is a pipeline stage over the tokens of one line. The built-in
+// token stages (transform.ConvertHexAndBin, transform.FixArticles,
+// transform.ApplyCaseRules) have this shape; wrap them, or any other
+// func([]string) []string, with TransformFunc.
+type Transform interface {
+	Apply(tokens []string) []string
+}
+
+// TransformFunc adapts an ordinary function to the Transform interface.
+type TransformFunc func(tokens []string) []string
+
+// Apply calls f(tokens).
+func (f TransformFunc) Apply(tokens []string) []string {
+	return f(tokens)
+}
+
+// Position is a point in the standard pipeline where extra stages run.
+type Position int
+
+const (
+	// BeforeNumbers runs right after tokenizing, before hex/bin conversion.
+	BeforeNumbers Position = iota
+	// AfterNumbers runs after hex/bin conversion.
+	AfterNumbers
+	// AfterArticles runs after a/an correction, before any marker stage.
+	AfterArticles
+	// AfterMarkers runs after the custom, range and case marker stages,
+	// before the line is rebuilt and its spacing fixed.
+	AfterMarkers
+)
+
+// Stage is an extra Transform run at the given Position. Stages at the
+// same position run in the order they are given.
+type Stage struct {
+	Position  Position
+	Transform Transform
+}
+
+// runStages applies every stage registered at pos to the tokens.
+func runStages(stages []Stage, pos Position, tokens []string) []string {
+	for _, s := range stages {
+		if s.Position == pos {
+			tokens = s.Transform.Apply(tokens)
+		}
+	}
+	return tokens
+}
@@ -0,0 +1,30 @@
+package testutil
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// BenchLines returns the lines of every file of the benchmark corpus in
+// tests/bench, the form the per-line stages receive from the pipeline.
+// The root package reads the same files whole.
+func BenchLines(tb testing.TB) []string {
+	_, file, _, _ := runtime.Caller(0)
+	dir := filepath.Join(filepath.Dir(file), "..", "..", "tests", "bench")
+	files, err := filepath.Glob(filepath.Join(dir, "*.txt"))
+	if err != nil || len(files) == 0 {
+		tb.Fatalf("no benchmark corpus in %s: %v", dir, err)
+	}
+	var lines []string
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			tb.Fatal(err)
+		}
+		lines = append(lines, strings.Split(strings.TrimSpace(string(data)), "\n")...)
+	}
+	return lines
+}
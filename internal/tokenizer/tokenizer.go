@@ -1,6 +1,13 @@
 package tokenizer
 
-import "strings"
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"go-reloaded/internal/diag"
+	"go-reloaded/internal/transform"
+)
 
 // Tokenize splits the text into words while keeping punctuation
 // as separate tokens and preserving markers like (up, 2).
@@ -12,7 +19,8 @@ import "strings"
 //
 // Design Decision: Punctuation as Word Boundaries
 //
-// This tokenizer treats all punctuation marks (.,!?;:) as word boundaries,
+// This tokenizer treats all punctuation marks (.,!?;: and the rest of
+// transform.DefaultPunctuation, such as … — ¿ %) as word boundaries,
 // meaning they always separate tokens. This design choice ensures:
 //
 //  1. Consistency: Punctuation always splits tokens, regardless of position
@@ -30,48 +38,190 @@ import "strings"
 // This behavior is intentional. Natural language text rarely has punctuation
 // in the middle of words, and this approach keeps the tokenizer simple while
 // handling the specification's requirements for normal cases.
+//
+// Parentheses:
+//
+// Only recognized markers (see Options.IsMarker) become a single token,
+// spaces included. Any other parenthesized text is tokenized normally, with
+// "(" and ")" as tokens of their own, so punctuation and article fixes
+// still apply inside it.
+//
+//   - "hello (up, 2)" → ["hello", "(up, 2)"]
+//   - "(see above ,please)" → ["(", "see", "above", ",", "please", ")"]
+//
+// Escaped Parentheses:
+//
+// A backslash before a parenthesis makes it ordinary text, so \(up) is not
+// applied as a marker. An escaped marker is still kept as one token with
+// the backslash, so its arguments are not respaced; the backslash is
+// removed at the end of the pipeline by transform.Unescape. The ")" that
+// closes any other escaped "(" is ordinary text as well.
+//
+//   - "\\(up) here" → ["\\(up)", "here"]
+//   - "\\(up, 2) here" → ["\\(up, 2)", "here"]
+//
+// Apostrophes:
+//
+// Quotes stay part of the word they touch; FixQuotes spaces them later.
+// When the punctuation classes include ' or ’, an apostrophe as found by
+// transform.IsApostrophe still stays inside its word:
+//
+//   - "the students' books" → ["the", "students'", "books"]
+//   - "rock 'n' roll" → ["rock", "'n'", "roll"]
 func Tokenize(text string) []string {
-	var tokens []string
-	current := ""
-	inParentheses := false // new flag to check if we are inside commands
+	tokens, _ := TokenizeWithDiagnostics(text)
+	return tokens
+}
+
+// TokenizeWithDiagnostics is Tokenize that also reports unmatched
+// parentheses. Diagnostics have no line number; the caller sets it.
+func TokenizeWithDiagnostics(text string) ([]string, []diag.Diagnostic) {
+	return TokenizeWithOptions(text, Options{})
+}
 
-	for _, r := range text {
-		ch := string(r)
+// Options configures TokenizeWithOptions.
+type Options struct {
+	// IsMarker reports whether parenthesized text is a marker to keep as
+	// a single token. Nil means transform.IsMarker.
+	IsMarker func(token string) bool
+	// Punctuation holds the punctuation marks that become tokens of their
+	// own, the same classes ApplyPunctuationRulesWithClasses spaces.
+	// Nil means transform.DefaultPunctuation.
+	Punctuation transform.PunctuationClasses
+}
+
+// TokenizeWithOptions is TokenizeWithDiagnostics with configurable
+// marker recognition, e.g. to include custom markers.
+func TokenizeWithOptions(text string, opts Options) ([]string, []diag.Diagnostic) {
+	isMarker := opts.IsMarker
+	if isMarker == nil {
+		isMarker = transform.IsMarker
+	}
+	// tokens are substrings of text: start is the byte offset of the word
+	// being built, or -1 when there is none
+	tokens := make([]string, 0, len(text)/4+1)
+	var diags []diag.Diagnostic
+	start := -1
+	escaped := false  // previous rune was a backslash
+	escapedDepth := 0 // escaped "(" still waiting for their ")"
+	openParens := 0   // "(" tokens still waiting for their ")"
+	skipUntil := 0    // byte offset just past a marker already emitted
+
+	flush := func(end int) {
+		if start >= 0 {
+			tokens = append(tokens, text[start:end])
+			start = -1
+		}
+	}
+	extend := func(i int) {
+		if start < 0 {
+			start = i
+		}
+	}
+
+	for i, r := range text {
+		if i < skipUntil {
+			continue
+		}
+		wasEscaped := escaped
+		escaped = r == '\\'
 
 		switch {
+		case wasEscaped && r == '(':
+			if end := markerEnd(text, i, isMarker); end > 0 {
+				// an escaped marker stays one token, arguments and all
+				extend(i)
+				tokens = append(tokens, text[start:end])
+				start = -1
+				skipUntil = end
+				continue
+			}
+			escapedDepth++
+			extend(i)
+
+		case (wasEscaped || escapedDepth > 0) && r == ')':
+			if !wasEscaped {
+				escapedDepth--
+			}
+			extend(i)
+
 		case r == '(':
-			if current != "" {
-				tokens = append(tokens, current)
-				current = ""
+			flush(i)
+			if end := markerEnd(text, i, isMarker); end > 0 {
+				tokens = append(tokens, text[i:end])
+				skipUntil = end
+				continue
 			}
-			inParentheses = true
-			current += ch
+			openParens++
+			if end := markerStartEnd(text, i, isMarker); end > 0 {
+				tokens = append(tokens, text[i:end])
+				skipUntil = end
+				continue
+			}
+			tokens = append(tokens, text[i:i+1])
 
 		case r == ')':
-			current += ch
-			inParentheses = false
-			tokens = append(tokens, current)
-			current = ""
-
-		case strings.ContainsRune(" \n\t", r) && !inParentheses:
-			if current != "" {
-				tokens = append(tokens, current)
-				current = ""
+			flush(i)
+			if openParens == 0 {
+				diags = append(diags, diag.Diagnostic{Message: "unmatched \")\""})
+			} else {
+				openParens--
 			}
+			tokens = append(tokens, text[i:i+1])
 
-		case strings.ContainsRune(".,!?;:", r) && !inParentheses:
-			if current != "" {
-				tokens = append(tokens, current)
-				current = ""
-			}
-			tokens = append(tokens, ch)
+		case isSpace(r):
+			flush(i)
+
+		case opts.Punctuation.IsPunctuation(r) && !transform.IsApostrophe(text, i, false):
+			flush(i)
+			tokens = append(tokens, text[i:i+utf8.RuneLen(r)])
 
 		default:
-			current += ch
+			extend(i)
 		}
 	}
-	if current != "" {
-		tokens = append(tokens, current)
+	flush(len(text))
+	if openParens > 0 {
+		diags = append(diags, diag.Diagnostic{Message: "unmatched \"(\""})
 	}
-	return tokens
+	return tokens, diags
+}
+
+// isSpace is unicode.IsSpace with a fast path for ASCII.
+func isSpace(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r == ' ' || ('\t' <= r && r <= '\r')
+	}
+	return unicode.IsSpace(r)
+}
+
+// markerEnd returns the byte offset just past the marker that starts with
+// the "(" at text[start], or 0 when the parenthesized text there is not a
+// recognized marker.
+func markerEnd(text string, start int, isMarker func(string) bool) int {
+	end := strings.IndexByte(text[start:], ')')
+	if end < 0 {
+		return 0
+	}
+	end += start + 1
+	if !isMarker(text[start:end]) {
+		return 0
+	}
+	return end
+}
+
+// markerStartEnd returns the byte offset just past the start of a marker
+// cut short by another "(", as in (up,(low)), or 0 when the text before
+// that "(" does not start a marker. The start stays one token, like the
+// marker it would be, so it is kept as written.
+func markerStartEnd(text string, start int, isMarker func(string) bool) int {
+	end := strings.IndexAny(text[start+1:], "()")
+	if end < 0 || text[start+1+end] != '(' {
+		return 0
+	}
+	end = start + 1 + len(strings.TrimRightFunc(text[start+1:start+1+end], unicode.IsSpace))
+	if !isMarker(text[start:end] + ")") {
+		return 0
+	}
+	return end
 }
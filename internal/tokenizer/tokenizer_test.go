@@ -2,7 +2,13 @@ package tokenizer
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"go-reloaded/internal/testutil"
+	"go-reloaded/internal/transform"
 )
 
 func TestTokenize(t *testing.T) {
@@ -107,6 +113,11 @@ func TestTokenize(t *testing.T) {
 			input:    "hello!!!",
 			expected: []string{"hello", "!", "!", "!"},
 		},
+		{
+			name:     "extended punctuation",
+			input:    "¿qué?…word—word 50% [note]",
+			expected: []string{"¿", "qué", "?", "…", "word", "—", "word", "50", "%", "[", "note", "]"},
+		},
 		{
 			name:     "punctuation between numbers",
 			input:    "3.14",
@@ -117,6 +128,68 @@ func TestTokenize(t *testing.T) {
 			input:    "hello,world!test",
 			expected: []string{"hello", ",", "world", "!", "test"},
 		},
+		// Only recognized markers are grouped into one token
+		{
+			name:     "parenthesized prose is split",
+			input:    "(see the appendix , please)",
+			expected: []string{"(", "see", "the", "appendix", ",", "please", ")"},
+		},
+		{
+			name:     "unknown marker name is split",
+			input:    "hello (shout)",
+			expected: []string{"hello", "(", "shout", ")"},
+		},
+		{
+			name:     "prose starting with a marker name is split",
+			input:    "(up a hill , slowly)",
+			expected: []string{"(", "up", "a", "hill", ",", "slowly", ")"},
+		},
+		{
+			name:     "invalid marker arguments stay grouped",
+			input:    "test (up, -1)",
+			expected: []string{"test", "(up, -1)"},
+		},
+		{
+			name:     "malformed markers stay grouped",
+			input:    "a (up, ) b (up,  3x ) c (up, 2, extra)",
+			expected: []string{"a", "(up, )", "b", "(up,  3x )", "c", "(up, 2, extra)"},
+		},
+		{
+			name:     "marker cut short by another marker stays grouped",
+			input:    "this is (up,(low)) nonsense",
+			expected: []string{"this", "is", "(up,", "(low)", ")", "nonsense"},
+		},
+		{
+			name:     "tolerant marker syntax stays grouped",
+			input:    "test ( UP ,2 ) x",
+			expected: []string{"test", "( UP ,2 )", "x"},
+		},
+		{
+			name:     "unclosed parenthesis does not swallow the line",
+			input:    "open (paren here, ok",
+			expected: []string{"open", "(", "paren", "here", ",", "ok"},
+		},
+		// Escaped parentheses are ordinary text
+		{
+			name:     "escaped marker",
+			input:    "write \\(up) here",
+			expected: []string{"write", "\\(up)", "here"},
+		},
+		{
+			name:     "escaped marker with arguments",
+			input:    "code \\(up, 2) and \\(low 3)",
+			expected: []string{"code", "\\(up, 2)", "and", "\\(low 3)"},
+		},
+		{
+			name:     "escaped parenthesis does not group spaces",
+			input:    "\\(see above)",
+			expected: []string{"\\(see", "above)"},
+		},
+		{
+			name:     "escaped marker followed by real marker",
+			input:    "\\(low) (up)",
+			expected: []string{"\\(low)", "(up)"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -157,3 +230,132 @@ func TestTokenizePreservesMarkers(t *testing.T) {
 		t.Error("Expected to find (low) marker in tokens")
 	}
 }
+
+func TestTokenizeWithDiagnostics(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected int
+	}{
+		{"balanced prose", "(see above) ok", 0},
+		{"marker only", "hello (up)", 0},
+		{"unclosed parenthesis", "open (paren here", 1},
+		{"stray closing parenthesis", "stray ) here", 1},
+		{"both unmatched", ") and (", 2},
+		{"escaped parentheses", "\\(see above)", 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, diags := TokenizeWithDiagnostics(tt.input)
+			if len(diags) != tt.expected {
+				t.Errorf("TokenizeWithDiagnostics(%q) gave %d diagnostics %v, want %d", tt.input, len(diags), diags, tt.expected)
+			}
+		})
+	}
+}
+
+func TestTokenizeApostrophes(t *testing.T) {
+	punct := transform.DefaultPunctuation()
+	punct['\''] = transform.NoSpace
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"don't stop", []string{"don't", "stop"}},
+		{"the students' books", []string{"the", "students'", "books"}},
+		{"rock 'n' roll", []string{"rock", "'n'", "roll"}},
+		{"'til goin' home", []string{"'til", "goin'", "home"}},
+		{"say 'hi'", []string{"say", "'", "hi", "'"}},
+	}
+
+	for _, tt := range tests {
+		tokens, _ := TokenizeWithOptions(tt.input, Options{Punctuation: punct})
+		if !reflect.DeepEqual(tokens, tt.expected) {
+			t.Errorf("TokenizeWithOptions(%q) = %q, want %q", tt.input, tokens, tt.expected)
+		}
+	}
+}
+
+// FuzzTokenize checks that tokenizing never panics and never loses or
+// invents text: apart from whitespace, the tokens spell out the input.
+func FuzzTokenize(f *testing.F) {
+	for _, seed := range []string{
+		"hello world (up, 2) !",
+		"(see the appendix , please)",
+		"open ( unclosed",
+		"stray ) here",
+		"\\(up) and \\\\(low)",
+		"it's 'quoted' \"text\"",
+		"1E (hex) 101 (bin)",
+		"αλφα (cap) ǆ ß",
+		"invalid \xff utf-8",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		tokens, _ := TokenizeWithDiagnostics(input)
+		for _, token := range tokens {
+			if token == "" {
+				t.Fatalf("Tokenize(%q) produced an empty token: %q", input, tokens)
+			}
+			if utf8.ValidString(input) && !utf8.ValidString(token) {
+				t.Fatalf("Tokenize(%q) produced invalid UTF-8 token %q", input, token)
+			}
+		}
+		var spelled strings.Builder
+		for _, token := range tokens {
+			// token by token: invalid bytes may form a rune once joined
+			spelled.WriteString(stripSpace(token))
+		}
+		if got, want := spelled.String(), stripSpace(input); got != want {
+			t.Fatalf("Tokenize(%q) = %q, which spells %q, want %q", input, tokens, got, want)
+		}
+	})
+}
+
+// stripSpace removes the whitespace the tokenizer splits on. Invalid
+// bytes are copied as they are rather than turned into U+FFFD, as
+// strings.Map would, so the result compares byte for byte.
+func stripSpace(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsSpace(r) {
+			b.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	return b.String()
+}
+
+func BenchmarkTokenize(b *testing.B) {
+	lines := testutil.BenchLines(b)
+	size := 0
+	for _, line := range lines {
+		size += len(line)
+	}
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			Tokenize(line)
+		}
+	}
+}
+
+// TestTokenizeAllocs guards the allocation-free scanning: tokens are
+// substrings of the input, so only the token slice is allocated, and
+// grown again on lines dense with punctuation.
+func TestTokenizeAllocs(t *testing.T) {
+	lines := testutil.BenchLines(t)
+	allocs := testing.AllocsPerRun(20, func() {
+		for _, line := range lines {
+			Tokenize(line)
+		}
+	}) / float64(len(lines))
+	if allocs > 2 {
+		t.Errorf("Tokenize: %.2f allocations per line, want at most 2", allocs)
+	}
+}
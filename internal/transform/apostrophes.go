@@ -0,0 +1,160 @@
+package transform
+
+import (
+	"strings"
+	"unicode/utf8"
+)
+
+// leadingElisions are words written with an apostrophe in place of their
+// first letters, like 'til for until.
+var leadingElisions = map[string]bool{
+	"tis": true, "twas": true, "til": true, "em": true, "cause": true,
+	"bout": true, "round": true, "nuff": true, "cept": true,
+}
+
+// trailingElisions are words written with an apostrophe in place of their
+// last letters, like ol' for old. Words ending in "in", like goin', are
+// recognized without a list.
+var trailingElisions = map[string]bool{
+	"ol": true, "o": true, "th": true,
+}
+
+// IsApostrophe reports whether the single quote at text[i], ' or ’ (or ‘,
+// often typed by mistake), is an apostrophe rather than a quote:
+//   - inside a word, as in don't or o'clock
+//   - at the start of a leading elision, as in 'til or '90s
+//   - around the n of rock 'n' roll
+//   - after a plural possessive or a trailing elision, as in the students'
+//     books or goin' home, unless quoteOpen is set: inside a single-quoted
+//     quotation such a quote closes the quotation
+//
+// quoteOpen also makes every leading elision an apostrophe, since the next
+// quote closes the quotation around it rather than the elision.
+//
+// Example:
+//
+//	Input:  "rock 'n' roll", 5, false
+//	Output: true
+func IsApostrophe(text string, i int, quoteOpen bool) bool {
+	ch, size := utf8.DecodeRuneInString(text[i:])
+	if !isSingleQuote(ch) {
+		return false
+	}
+	prev, _ := utf8.DecodeLastRuneInString(text[:i])
+	next, _ := utf8.DecodeRuneInString(text[i+size:])
+	switch {
+	case isWordRune(prev) && isWordRune(next):
+		return true
+	case isRockNRoll(text, i):
+		return true
+	case !isWordRune(prev) && isWordRune(next):
+		if quoteOpen {
+			return isElisionWord(text[i+size:])
+		}
+		return isLeadingElision(text[i+size:])
+	case isWordRune(prev) && !quoteOpen:
+		return isTrailingElision(text[:i])
+	}
+	return false
+}
+
+// isRockNRoll reports whether the quote at text[i] is one of the two
+// apostrophes of 'n'.
+func isRockNRoll(text string, i int) bool {
+	if isQuotedN(text, i) {
+		return true
+	}
+	if i < 1 || (text[i-1] != 'n' && text[i-1] != 'N') {
+		return false
+	}
+	_, size := utf8.DecodeLastRuneInString(text[:i-1])
+	return size > 0 && isQuotedN(text, i-1-size)
+}
+
+// isQuotedN reports whether text[start:] starts with 'n' standing alone.
+func isQuotedN(text string, start int) bool {
+	open, size := utf8.DecodeRuneInString(text[start:])
+	rest := text[start+size:]
+	if !isSingleQuote(open) || rest == "" || (rest[0] != 'n' && rest[0] != 'N') {
+		return false
+	}
+	closing, closeSize := utf8.DecodeRuneInString(rest[1:])
+	if !isSingleQuote(closing) {
+		return false
+	}
+	before, _ := utf8.DecodeLastRuneInString(text[:start])
+	after, _ := utf8.DecodeRuneInString(rest[1+closeSize:])
+	return !isWordRune(before) && !isWordRune(after)
+}
+
+// isTrailingElision reports whether the word at the end of before is a
+// plural possessive (students) or a trailing elision (goin, ol).
+func isTrailingElision(before string) bool {
+	word := before
+	if start := strings.LastIndexFunc(before, func(r rune) bool { return !isWordRune(r) }); start >= 0 {
+		_, size := utf8.DecodeRuneInString(before[start:])
+		word = before[start+size:]
+	}
+	word = strings.ToLower(word)
+	if trailingElisions[word] {
+		return true
+	}
+	if utf8.RuneCountInString(word) < 3 {
+		return false
+	}
+	return strings.HasSuffix(word, "s") && !startsWithDigit(word) ||
+		strings.HasSuffix(word, "in") && word != "in"
+}
+
+// isLeadingElision reports whether an apostrophe followed by after starts
+// a word with elided first letters, like 'til or a decade like '90s,
+// rather than a quotation. It is taken as quoted when the next quote can
+// close it, as in 'em' or '90s, I said'.
+func isLeadingElision(after string) bool {
+	if !isElisionWord(after) {
+		return false
+	}
+	end := elisionWordEnd(after)
+
+	// look for the next quote: it can close unless it is glued to the
+	// word after it, as in 'til 'now'
+	for j, r := range after[end:] {
+		if !isSingleQuote(r) {
+			continue
+		}
+		j += end
+		prev, _ := utf8.DecodeLastRuneInString(after[:j])
+		next, _ := utf8.DecodeRuneInString(after[j+utf8.RuneLen(r):])
+		if isWordRune(prev) && (isWordRune(next) || isTrailingElision(after[:j])) {
+			// an apostrophe
+			continue
+		}
+		return isWordRune(next) && !isWordRune(prev)
+	}
+	return true
+}
+
+// isElisionWord reports whether after starts with a word that is written
+// with an apostrophe in front, like til or 90s.
+func isElisionWord(after string) bool {
+	word := after[:elisionWordEnd(after)]
+	if leadingElisions[strings.ToLower(word)] {
+		return true
+	}
+	decade := strings.TrimSuffix(word, "s")
+	return len(decade) == 2 && startsWithDigit(decade) && endsWithDigit(decade)
+}
+
+// elisionWordEnd returns the end of the word at the start of after.
+func elisionWordEnd(after string) int {
+	end := strings.IndexFunc(after, func(r rune) bool { return !isWordRune(r) })
+	if end < 0 {
+		return len(after)
+	}
+	return end
+}
+
+// isSingleQuote reports whether r is a straight or curly single quote.
+func isSingleQuote(r rune) bool {
+	return r == '\'' || r == '’' || r == '‘'
+}
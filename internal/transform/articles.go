@@ -5,19 +5,24 @@ import "strings"
 // FixArticles checks every occurrence of "a" in the text and changes it
 // to "an" if the next word starts with a vowel (a, e, i, o, u) or 'h'.
 // The comparison is case-insensitive, and the loop stops before the last
-// word to prevent out-of-range errors.
+// word to prevent out-of-range errors. Markers between the article and
+// the next word are skipped, since they are removed from the output.
 func FixArticles(words []string) []string {
 	for i := 0; i < len(words)-1; i++ { // stop before the last word
 		// Strip leading quotes to check if this is an article
-		currentLower := strings.ToLower(strings.Trim(words[i], "\"'"))
+		currentLower := strings.ToLower(strings.Trim(words[i], quoteChars))
 		if currentLower != "a" {
 			continue
 		}
 
 		// Peek next token and ignore leading quotes when deciding
-		nextLower := strings.ToLower(words[i+1])
-		// Strip ASCII quotes at the start (common in our tokenization)
-		trimmed := strings.TrimLeft(nextLower, "'\"")
+		next := i + 1
+		for next < len(words)-1 && IsMarker(words[next]) {
+			next++
+		}
+		nextLower := strings.ToLower(words[next])
+		// Strip quotes at the start (common in our tokenization)
+		trimmed := strings.TrimLeft(nextLower, quoteChars)
 		if trimmed == "" {
 			continue
 		}
@@ -9,14 +9,23 @@ import (
 // ParseMarkerCount extracts the count from markers like (up, 3) or (low, 2).
 // Returns (n, true) when a valid positive integer is present; otherwise (0, false).
 // Invalid counts (negative, zero, or malformed) return (0, false).
+// The count may also be given by name, as in (up, count=3).
 func ParseMarkerCount(token string) (int, bool) {
-	token = strings.TrimSuffix(strings.TrimPrefix(token, "("), ")")
-	parts := strings.Split(token, ",")
-	if len(parts) < 2 {
+	m, ok := ParseMarker(token)
+	if !ok {
 		return 0, false
 	}
-	numStr := strings.TrimSpace(parts[1])
-	n, err := strconv.Atoi(numStr)
+	for _, arg := range m.Args {
+		if (arg.Key == "" || arg.Key == "count") && arg.IsNumber() {
+			return markerCount(arg)
+		}
+	}
+	return 0, false
+}
+
+// markerCount converts a numeric argument to a positive count.
+func markerCount(arg MarkerArg) (int, bool) {
+	n, err := strconv.Atoi(arg.Value)
 	if err != nil || n <= 0 {
 		return 0, false
 	}
@@ -25,83 +34,467 @@ func ParseMarkerCount(token string) (int, bool) {
 
 // Capitalize turns the first letter uppercase and the rest lowercase.
 func Capitalize(word string) string {
-	if word == "" {
-		return word
+	return CapitalizeLang(word, LangDefault)
+}
+
+// CapitalizeLang is Capitalize using the casing rules of lang.
+// The first rune is converted to titlecase, so digraphs like ǆ become ǅ.
+func CapitalizeLang(word string, lang Lang) string {
+	return CapitalizeWithOptions(word, lang, CapitalizeOptions{})
+}
+
+// CapitalizeOptions selects how capitalization treats the rest of a word.
+// The zero value matches Capitalize.
+type CapitalizeOptions struct {
+	// Keep leaves every letter after the first untouched,
+	// so "mcDonald" becomes "McDonald" instead of "Mcdonald".
+	Keep bool
+	// Compound also capitalizes each hyphen-joined part ("Well-Known")
+	// and the letter after a one-letter apostrophe prefix ("O'Neil").
+	Compound bool
+}
+
+// CapitalizeWithOptions is CapitalizeLang with configurable handling of
+// inner capitals, hyphens and apostrophes. Leading quotes and punctuation,
+// as in "hi!", are skipped: the first letter or digit is the one that is
+// capitalized.
+func CapitalizeWithOptions(word string, lang Lang, opts CapitalizeOptions) string {
+	var b strings.Builder
+	runes := []rune(word)
+	first := 0
+	for first < len(runes)-1 && !isWordRune(runes[first]) {
+		b.WriteRune(runes[first])
+		first++
+	}
+	for i := first; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case i == first || (opts.Compound && startsCompoundPart(runes, i)):
+			b.WriteString(titleRune(r, lang))
+		case opts.Keep:
+			b.WriteRune(r)
+		default:
+			b.WriteString(lowerRune(runes, i, lang))
+		}
+	}
+	return b.String()
+}
+
+// startsCompoundPart reports whether runes[i] begins a new part of a
+// compound word: it follows a hyphen, or an apostrophe that follows a
+// single letter (o'neil, d'artagnan, but not don't).
+func startsCompoundPart(runes []rune, i int) bool {
+	prev := runes[i-1]
+	if prev == '-' {
+		return true
+	}
+	if (prev != '\'' && prev != '’') || i < 2 || !unicode.IsLetter(runes[i-2]) {
+		return false
 	}
+	return i == 2 || !unicode.IsLetter(runes[i-3])
+}
+
+// SwapCase turns every uppercase letter lowercase and every lowercase
+// letter uppercase. Runes without case are left unchanged.
+func SwapCase(word string, lang Lang) string {
+	var b strings.Builder
 	runes := []rune(word)
-	runes[0] = unicode.ToUpper(runes[0])
-	for i := 1; i < len(runes); i++ {
-		runes[i] = unicode.ToLower(runes[i])
+	for i, r := range runes {
+		switch {
+		case unicode.IsUpper(r) || unicode.IsTitle(r):
+			b.WriteString(lowerRune(runes, i, lang))
+		case unicode.IsLower(r):
+			b.WriteString(upperRune(r, lang))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// SentenceCase lowercases the given words and capitalizes the first one,
+// so "THE QUICK FOX" becomes "The quick fox".
+func SentenceCase(words []string, lang Lang) []string {
+	for i := range words {
+		if i == 0 {
+			words[i] = CapitalizeLang(words[i], lang)
+			continue
+		}
+		words[i] = ToLower(words[i], lang)
+	}
+	return words
+}
+
+// CamelCase joins the words into one identifier like "userAccountId".
+func CamelCase(words []string, lang Lang) string {
+	var b strings.Builder
+	for i, w := range words {
+		if i == 0 {
+			b.WriteString(ToLower(w, lang))
+			continue
+		}
+		b.WriteString(CapitalizeLang(w, lang))
 	}
-	return string(runes)
+	return b.String()
 }
 
-// ApplyCaseRules detects (up), (low) and (cap) markers
-// and applies the appropriate transformation to the
-// previous one or multiple words. Markers are removed from the final output.
+// PascalCase joins the words into one identifier like "UserAccountId".
+func PascalCase(words []string, lang Lang) string {
+	var b strings.Builder
+	for _, w := range words {
+		b.WriteString(CapitalizeLang(w, lang))
+	}
+	return b.String()
+}
+
+// SnakeCase joins the words into one identifier like "user_account_id".
+func SnakeCase(words []string, lang Lang) string {
+	return joinLower(words, "_", lang)
+}
+
+// KebabCase joins the words into one identifier like "user-account-id".
+func KebabCase(words []string, lang Lang) string {
+	return joinLower(words, "-", lang)
+}
+
+// joinLower lowercases every word and joins them with sep.
+func joinLower(words []string, sep string, lang Lang) string {
+	lowered := make([]string, len(words))
+	for i, w := range words {
+		lowered[i] = ToLower(w, lang)
+	}
+	return strings.Join(lowered, sep)
+}
+
+// caseFunc transforms the span of previous words targeted by a marker.
+type caseFunc func(words []string, lang Lang) []string
+
+// eachWord lifts a single-word case function to a span function.
+func eachWord(f func(string, Lang) string) caseFunc {
+	return func(words []string, lang Lang) []string {
+		for i := range words {
+			words[i] = f(words[i], lang)
+		}
+		return words
+	}
+}
+
+// mergeWords lifts an identifier joiner to a span function that
+// replaces the whole span with the single joined word.
+func mergeWords(join func([]string, Lang) string) caseFunc {
+	return func(words []string, lang Lang) []string {
+		return []string{join(words, lang)}
+	}
+}
+
+// caseMarkers maps every case marker name to the transformation applied
+// to the span of previous words it targets. Identifier markers (camel,
+// snake, kebab, pascal) merge the span into a single word.
+var caseMarkers = map[string]caseFunc{
+	"up":       eachWord(ToUpper),
+	"low":      eachWord(ToLower),
+	"cap":      eachWord(CapitalizeLang),
+	"swap":     eachWord(SwapCase),
+	"sentence": SentenceCase,
+	"camel":    mergeWords(CamelCase),
+	"snake":    mergeWords(SnakeCase),
+	"kebab":    mergeWords(KebabCase),
+	"pascal":   mergeWords(PascalCase),
+}
+
+// capitalizeModes maps the optional mode arguments of the (cap) marker,
+// as in (cap, 2, keep), to the option they enable.
+var capitalizeModes = map[string]func(*CapitalizeOptions){
+	"keep":     func(o *CapitalizeOptions) { o.Keep = true },
+	"compound": func(o *CapitalizeOptions) { o.Compound = true },
+}
+
+// caseMarker is a parsed case marker such as (up, 2) or (cap, keep).
+type caseMarker struct {
+	name     string
+	count    int
+	hasCount bool
+	// forward is set by a "+n" count, as in (up, +3), which applies
+	// to the following words instead (see ApplyRangeMarkers).
+	forward bool
+	// quote is set by (up, quote): the marker applies to the quotation
+	// right before it, see quoteTargets.
+	quote bool
+	cap   CapitalizeOptions
+}
+
+// parseCaseMarker parses tokens like "(up)", "(snake, 3)" or
+// "(cap, 2, keep)" that are not range markers.
+func parseCaseMarker(token string) (caseMarker, bool) {
+	m, ok := ParseMarker(token)
+	if !ok || m.Phase != "" {
+		return caseMarker{}, false
+	}
+	return caseMarkerFrom(m)
+}
+
+// caseMarkerFrom interprets a parsed marker as a case marker. Arguments
+// are a count (positional or count=n, "+n" for forward markers), the
+// quote scope (positional or scope=quote) and, for (cap) only, modes
+// (positional or mode=keep). It reports false for unknown names and
+// unknown or repeated arguments, which are then kept as literal text.
+func caseMarkerFrom(m Marker) (caseMarker, bool) {
+	cm := caseMarker{name: m.Name}
+	if _, ok := caseMarkers[cm.name]; !ok {
+		return cm, false
+	}
+	for _, arg := range m.Args {
+		switch {
+		case (arg.Key == "" || arg.Key == "count") && arg.IsNumber():
+			n, ok := markerCount(arg)
+			if !ok || cm.hasCount {
+				return cm, false
+			}
+			cm.count, cm.hasCount = n, true
+			cm.forward = strings.HasPrefix(arg.Value, "+")
+		case (arg.Key == "" || arg.Key == "scope") && arg.Value == "quote":
+			if cm.quote {
+				return cm, false
+			}
+			cm.quote = true
+		case arg.Key == "" || arg.Key == "mode":
+			setMode, ok := capitalizeModes[arg.Value]
+			if !ok || cm.name != "cap" {
+				return cm, false
+			}
+			setMode(&cm.cap)
+		default:
+			return cm, false
+		}
+	}
+	if cm.quote && cm.forward {
+		return cm, false
+	}
+	return cm, true
+}
+
+// ApplyCaseRules detects case markers and applies the appropriate
+// transformation to the previous one or multiple words.
+// Markers are removed from the final output.
+//
+// Markers follow the grammar documented on Marker, so (UP), ( up ) and
+// (up 2) are accepted too. Supported markers, each with an optional
+// count as in (up, 2):
+//   - (up), (low), (cap): upper, lower and capitalized case
+//   - (cap, keep), (cap, compound): see CapitalizeOptions; modes may be
+//     combined with a count, e.g. (cap, 2, keep)
+//   - (swap): toggles the case of every letter
+//   - (sentence): capitalizes the first word and lowercases the rest
+//   - (camel), (snake), (kebab), (pascal): merge the words into one identifier
+//
+// With the quote argument, as in (up, quote), a marker applies to the
+// whole quotation that ends right before it, and a count, as in
+// (up, 2, quote), counts words inside that quotation only. Without a
+// quotation before it on the line the marker is kept as literal text.
+//
+// Example:
+//
+//	Input:  ["user", "account", "id", "(snake, 3)"]
+//	Output: ["user_account_id"]
 func ApplyCaseRules(words []string) []string {
-	var result []string
+	return ApplyCaseRulesWithOptions(words, CaseOptions{})
+}
+
+// CaseOptions configures ApplyCaseRulesWithOptions.
+// The zero value matches ApplyCaseRules.
+type CaseOptions struct {
+	// Lang selects language-specific casing rules, e.g. LangTurkish.
+	Lang Lang
+	// CountPunctuation counts punctuation and quote-only tokens as words
+	// when applying a marker count, as earlier versions did. By default
+	// "hello , world (up, 2)" uppercases both words.
+	CountPunctuation bool
+	// CustomMarkers are applied in the same left-to-right pass as the
+	// built-in markers, so "github (up) (brand)" uppercases first.
+	CustomMarkers CustomMarkers
+}
+
+// isMarker reports whether the token is a built-in or a custom marker.
+func (o CaseOptions) isMarker(token string) bool {
+	return IsMarker(token) || o.CustomMarkers.IsMarker(token)
+}
+
+// ApplyCaseRulesWithOptions is ApplyCaseRules with configurable behavior.
+func ApplyCaseRulesWithOptions(words []string, opts CaseOptions) []string {
+	result := make([]string, 0, len(words))
 
 	for i := 0; i < len(words); i++ {
 		word := words[i]
 
-		// Handle (up, n)
-		if strings.HasPrefix(word, "(up,") && strings.HasSuffix(word, ")") {
-			if n, ok := ParseMarkerCount(word); ok {
-				for j := 1; j <= n && len(result)-j >= 0; j++ {
-					result[len(result)-j] = strings.ToUpper(result[len(result)-j])
-				}
-				// consume marker
-				continue
-			}
-			// invalid marker: keep as literal
-			result = append(result, word)
+		if custom, ok := applyCustomMarker(result, word, opts); ok {
+			result = custom
 			continue
 		}
-
-		// Handle (low, n)
-		if strings.HasPrefix(word, "(low,") && strings.HasSuffix(word, ")") {
-			if n, ok := ParseMarkerCount(word); ok {
-				for j := 1; j <= n && len(result)-j >= 0; j++ {
-					result[len(result)-j] = strings.ToLower(result[len(result)-j])
-				}
-				continue
-			}
+		marker, ok := parseCaseMarker(word)
+		if !ok || marker.forward {
+			// not a marker, invalid, or forward (handled by
+			// ApplyRangeMarkers): keep as literal
 			result = append(result, word)
 			continue
 		}
 
-		// Handle (cap, n)
-		if strings.HasPrefix(word, "(cap,") && strings.HasSuffix(word, ")") {
-			if n, ok := ParseMarkerCount(word); ok {
-				for j := 1; j <= n && len(result)-j >= 0; j++ {
-					result[len(result)-j] = Capitalize(result[len(result)-j])
-				}
+		n := 1
+		if marker.hasCount {
+			n = marker.count
+		}
+		var targets []int
+		if marker.quote {
+			targets = quoteTargets(result, n, marker.hasCount, opts)
+			if len(targets) == 0 {
+				// no quotation to apply to: keep as literal
+				result = append(result, word)
 				continue
 			}
-			result = append(result, word)
+		} else {
+			targets = markerTargets(result, n, opts)
+		}
+		if len(targets) == 0 {
+			if !marker.hasCount {
+				// (up) with no previous word: keep as literal
+				result = append(result, word)
+			}
+			// nothing to transform, a counted marker is still consumed
 			continue
 		}
 
-		// Handle (up)
-		if word == "(up)" && len(result) > 0 {
-			result[len(result)-1] = strings.ToUpper(result[len(result)-1])
-			continue
+		// consume marker
+		result = applyToTargets(result, targets, marker.caseFunc(), opts.Lang)
+	}
+	return result
+}
+
+// caseFunc returns the transformation the marker applies to its words.
+func (m caseMarker) caseFunc() caseFunc {
+	if m.cap == (CapitalizeOptions{}) {
+		return caseMarkers[m.name]
+	}
+	capOpts := m.cap
+	return eachWord(func(w string, lang Lang) string {
+		return CapitalizeWithOptions(w, lang, capOpts)
+	})
+}
+
+// isPunctuationToken reports whether the token consists only of
+// punctuation and quote characters, like "," or "...".
+func isPunctuationToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for _, r := range token {
+		if !unicode.IsPunct(r) {
+			return false
 		}
+	}
+	return true
+}
 
-		// Handle (low)
-		if word == "(low)" && len(result) > 0 {
-			result[len(result)-1] = strings.ToLower(result[len(result)-1])
+// markerTargets returns the indices, in ascending order, of the last n
+// words in tokens. Punctuation tokens are skipped unless
+// opts.CountPunctuation is set; markers kept as literal text, custom ones
+// included, are always skipped.
+func markerTargets(tokens []string, n int, opts CaseOptions) []int {
+	var targets []int
+	for i := len(tokens) - 1; i >= 0 && len(targets) < n; i-- {
+		if (!opts.CountPunctuation && isPunctuationToken(tokens[i])) || opts.isMarker(tokens[i]) {
 			continue
 		}
+		targets = append(targets, i)
+	}
+	for l, r := 0, len(targets)-1; l < r; l, r = l+1, r-1 {
+		targets[l], targets[r] = targets[r], targets[l]
+	}
+	return targets
+}
 
-		// Handle (cap)
-		if word == "(cap)" && len(result) > 0 {
-			result[len(result)-1] = Capitalize(result[len(result)-1])
-			continue
+// quoteTargets returns the indices, in ascending order, of the words of
+// the quotation that ends right before the end of tokens, only followed by
+// punctuation or markers: the last n of them if hasCount is set, all of
+// them otherwise. It returns nil when there is no such quotation. Quotes
+// pair up as in FixQuotes, so for a nested quotation the outer one counts.
+func quoteTargets(tokens []string, n int, hasCount bool, opts CaseOptions) []int {
+	// the last word, where the quotation must end
+	last := len(tokens) - 1
+	for last >= 0 && (isPunctuationToken(tokens[last]) || opts.isMarker(tokens[last])) &&
+		!strings.ContainsAny(tokens[last], quoteChars) {
+		last--
+	}
+	if last < 0 || !strings.ContainsAny(tokens[last], quoteChars) {
+		return nil
+	}
+
+	// pair the quotes up to the last word, tracking the token that opened
+	// every open quote
+	text := strings.Join(tokens[:last+1], " ")
+	s := quoteScanner{profile: SpacingFor(LangDefault)}
+	var openedAt []int
+	first := -1
+	offset := 0
+	for t, token := range tokens[:last+1] {
+		first = -1
+		for i := range token {
+			m, _ := s.next(text, offset+i, 0)
+			switch m.role {
+			case openingQuote:
+				openedAt = append(openedAt, t)
+			case closingQuote:
+				first = openedAt[len(s.open)]
+				openedAt = openedAt[:len(s.open)]
+			}
 		}
-		result = append(result, word)
+		offset += len(token) + 1
+	}
+	if first < 0 {
+		return nil
 	}
-	return result
 
+	span := tokens[first : last+1]
+	if !hasCount {
+		n = len(span)
+	}
+	targets := markerTargets(span, n, opts)
+	for i := range targets {
+		targets[i] += first
+	}
+	return targets
+}
+
+// applyToTargets runs apply over the target words of tokens. When apply
+// merges the words into one, the merged word takes the place of the
+// first target and skipped punctuation tokens follow it.
+func applyToTargets(tokens []string, targets []int, apply caseFunc, lang Lang) []string {
+	span := make([]string, len(targets))
+	for i, idx := range targets {
+		span[i] = tokens[idx]
+	}
+	span = apply(span, lang)
+	if len(span) == len(targets) {
+		for i, idx := range targets {
+			tokens[idx] = span[i]
+		}
+		return tokens
+	}
+
+	first := targets[0]
+	rest := make([]string, 0, len(tokens)-first)
+	for i := first; i < len(tokens); i++ {
+		if !containsIndex(targets, i) {
+			rest = append(rest, tokens[i])
+		}
+	}
+	return append(append(tokens[:first], span...), rest...)
+}
+
+// containsIndex reports whether idx is one of the indices.
+func containsIndex(indices []int, idx int) bool {
+	for _, i := range indices {
+		if i == idx {
+			return true
+		}
+	}
+	return false
 }
@@ -0,0 +1,221 @@
+package transform
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Actions a custom marker can perform on each word it targets.
+const (
+	// ActionTable replaces a word with its canonical spelling from Table.
+	// The lookup is case-insensitive; words not in the table are kept.
+	ActionTable = "table"
+	// ActionReplace replaces the word with the fixed text With.
+	ActionReplace = "replace"
+	// ActionWrap adds Prefix before the word and Suffix after it.
+	ActionWrap = "wrap"
+	// ActionRegex replaces every match of Pattern with Replace, which
+	// may refer to capture groups as $1 or ${name}.
+	ActionRegex = "regex"
+)
+
+// CustomMarker is a project-specific marker defined in a config file.
+// Only the fields used by its Action are set.
+type CustomMarker struct {
+	Action  string            `json:"action"`
+	Table   map[string]string `json:"table,omitempty"`
+	With    string            `json:"with,omitempty"`
+	Prefix  string            `json:"prefix,omitempty"`
+	Suffix  string            `json:"suffix,omitempty"`
+	Pattern string            `json:"pattern,omitempty"`
+	Replace string            `json:"replace,omitempty"`
+
+	re *regexp.Regexp
+}
+
+// CustomMarkers maps lowercase marker names to their definitions.
+type CustomMarkers map[string]*CustomMarker
+
+// ParseCustomMarkers reads custom marker definitions from JSON:
+//
+//	{
+//	  "markers": {
+//	    "brand":  {"action": "table", "table": {"iphone": "iPhone"}},
+//	    "redact": {"action": "replace", "with": "█████"},
+//	    "em":     {"action": "wrap", "prefix": "*", "suffix": "*"},
+//	    "digits": {"action": "regex", "pattern": "[0-9]", "replace": "#"}
+//	  }
+//	}
+//
+// Names must be valid marker names and may not shadow built-in markers.
+func ParseCustomMarkers(data []byte) (CustomMarkers, error) {
+	var config struct {
+		Markers map[string]*CustomMarker `json:"markers"`
+	}
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&config); err != nil {
+		return nil, fmt.Errorf("invalid marker config: %w", err)
+	}
+
+	markers := make(CustomMarkers, len(config.Markers))
+	for name, cm := range config.Markers {
+		m, ok := ParseMarker("(" + name + ")")
+		if !ok || m.Phase != "" || len(m.Args) > 0 {
+			return nil, fmt.Errorf("marker %q: invalid marker name", name)
+		}
+		if IsMarker("(" + m.Name + ")") {
+			return nil, fmt.Errorf("marker %q: name is used by a built-in marker", name)
+		}
+		if cm == nil {
+			return nil, fmt.Errorf("marker %q: missing definition", name)
+		}
+		if err := cm.compile(); err != nil {
+			return nil, fmt.Errorf("marker %q: %w", name, err)
+		}
+		markers[m.Name] = cm
+	}
+	return markers, nil
+}
+
+// compile validates the definition and prepares it for use.
+func (cm *CustomMarker) compile() error {
+	switch cm.Action {
+	case ActionTable:
+		if len(cm.Table) == 0 {
+			return fmt.Errorf("action %q needs a table", cm.Action)
+		}
+		table := make(map[string]string, len(cm.Table))
+		for word, canonical := range cm.Table {
+			table[strings.ToLower(word)] = canonical
+		}
+		cm.Table = table
+	case ActionReplace:
+		if cm.With == "" {
+			return fmt.Errorf("action %q needs a with value", cm.Action)
+		}
+	case ActionWrap:
+		if cm.Prefix == "" && cm.Suffix == "" {
+			return fmt.Errorf("action %q needs a prefix or suffix", cm.Action)
+		}
+	case ActionRegex:
+		re, err := regexp.Compile(cm.Pattern)
+		if err != nil {
+			return fmt.Errorf("action %q: %w", cm.Action, err)
+		}
+		cm.re = re
+	default:
+		return fmt.Errorf("unknown action %q", cm.Action)
+	}
+	return nil
+}
+
+// Apply performs the marker's action on one word.
+func (cm *CustomMarker) Apply(word string) string {
+	switch cm.Action {
+	case ActionTable:
+		if canonical, ok := cm.Table[strings.ToLower(word)]; ok {
+			return canonical
+		}
+	case ActionReplace:
+		return cm.With
+	case ActionWrap:
+		return cm.Prefix + word + cm.Suffix
+	case ActionRegex:
+		if cm.re != nil {
+			return cm.re.ReplaceAllString(word, cm.Replace)
+		}
+	}
+	return word
+}
+
+// IsMarker reports whether the token is one of the custom markers, with
+// arguments a marker can take or malformed ones (see IsMarker).
+func (c CustomMarkers) IsMarker(token string) bool {
+	name, ok := markerName(token)
+	if !ok {
+		return false
+	}
+	_, ok = c[name]
+	return ok
+}
+
+// ApplyCustomMarkers applies custom markers to the previous one or
+// multiple words, with the same counting rules as ApplyCaseRules:
+// (brand) targets one word, (redact, 2) the previous two, punctuation
+// tokens are skipped unless opts.CountPunctuation is set, and markers
+// with invalid arguments are kept as literal text. To apply them in
+// order with the built-in markers, set CaseOptions.CustomMarkers and use
+// ApplyCaseRulesWithOptions instead.
+//
+// Example, with "redact" defined as {"action": "replace", "with": "█████"}:
+//
+//	Input:  ["call", "555", "1234", "(redact, 2)"]
+//	Output: ["call", "█████", "█████"]
+func ApplyCustomMarkers(words []string, markers CustomMarkers, opts CaseOptions) []string {
+	if len(markers) == 0 {
+		return words
+	}
+	opts.CustomMarkers = markers
+	result := make([]string, 0, len(words))
+
+	for _, word := range words {
+		if custom, ok := applyCustomMarker(result, word, opts); ok {
+			result = custom
+			continue
+		}
+		result = append(result, word)
+	}
+	return result
+}
+
+// applyCustomMarker applies word to result when it is one of
+// opts.CustomMarkers and returns the new result. It returns false when
+// word is not a custom marker.
+func applyCustomMarker(result []string, word string, opts CaseOptions) ([]string, bool) {
+	if len(opts.CustomMarkers) == 0 {
+		return nil, false
+	}
+	m, ok := ParseMarker(word)
+	cm := opts.CustomMarkers[m.Name]
+	if !ok || m.Phase != "" || cm == nil {
+		return nil, false
+	}
+
+	n, hasCount, valid := customMarkerCount(m)
+	if !valid {
+		// invalid marker: keep as literal
+		return append(result, word), true
+	}
+	targets := markerTargets(result, n, opts)
+	if len(targets) == 0 {
+		if !hasCount {
+			// no previous word: keep as literal
+			result = append(result, word)
+		}
+		return result, true
+	}
+	apply := eachWord(func(w string, _ Lang) string { return cm.Apply(w) })
+	// consume marker
+	return applyToTargets(result, targets, apply, opts.Lang), true
+}
+
+// customMarkerCount returns the count of a custom marker, which accepts
+// a single positive count (positional or count=n) and nothing else.
+func customMarkerCount(m Marker) (n int, hasCount, valid bool) {
+	switch {
+	case len(m.Args) == 0:
+		return 1, false, true
+	case len(m.Args) > 1:
+		return 0, false, false
+	}
+	arg := m.Args[0]
+	if (arg.Key != "" && arg.Key != "count") || !arg.IsNumber() || strings.HasPrefix(arg.Value, "+") {
+		return 0, false, false
+	}
+	n, ok := markerCount(arg)
+	return n, true, ok
+}
@@ -0,0 +1,147 @@
+package transform
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+// Lang selects language-specific rules. The zero value applies the
+// language-neutral Unicode rules.
+type Lang string
+
+const (
+	// LangDefault applies the language-neutral Unicode rules.
+	LangDefault Lang = ""
+	// LangEnglish selects English rules (same casing as LangDefault).
+	LangEnglish Lang = "en"
+	// LangTurkish selects Turkish rules (dotted İ/i and dotless I/ı).
+	LangTurkish Lang = "tr"
+	// LangGreek selects Greek rules (accents dropped in uppercase).
+	LangGreek Lang = "el"
+	// LangFrench selects French punctuation spacing (see SpacingFor).
+	LangFrench Lang = "fr"
+	// LangGerman selects German quotes (see SpacingFor).
+	LangGerman Lang = "de"
+	// LangSpanish selects Spanish rules (same as LangDefault).
+	LangSpanish Lang = "es"
+)
+
+// ParseLang validates a language code such as "tr", "el" or "fr".
+// An empty string selects LangDefault.
+func ParseLang(code string) (Lang, error) {
+	switch lang := Lang(strings.ToLower(strings.TrimSpace(code))); lang {
+	case LangDefault, LangEnglish, LangTurkish, LangGreek, LangFrench, LangGerman, LangSpanish:
+		return lang, nil
+	}
+	return LangDefault, fmt.Errorf("unsupported language %q", code)
+}
+
+// specialUpper holds the unconditional full case mappings from Unicode
+// SpecialCasing.txt that expand a single rune into several.
+var specialUpper = map[rune]string{
+	'ß': "SS",
+	'ﬀ': "FF",
+	'ﬁ': "FI",
+	'ﬂ': "FL",
+	'ﬃ': "FFI",
+	'ﬄ': "FFL",
+	'ﬅ': "ST",
+	'ﬆ': "ST",
+	'ŉ': "ʼN",
+}
+
+// specialTitle is the titlecase counterpart of specialUpper.
+var specialTitle = map[rune]string{
+	'ß': "Ss",
+	'ﬀ': "Ff",
+	'ﬁ': "Fi",
+	'ﬂ': "Fl",
+	'ﬃ': "Ffi",
+	'ﬄ': "Ffl",
+	'ﬅ': "St",
+	'ﬆ': "St",
+	'ŉ': "ʼN",
+}
+
+// greekUpperNoAccent maps accented Greek vowels to the unaccented capital
+// letter used when Greek text is written in all capitals.
+var greekUpperNoAccent = map[rune]rune{
+	'ά': 'Α', 'Ά': 'Α',
+	'έ': 'Ε', 'Έ': 'Ε',
+	'ή': 'Η', 'Ή': 'Η',
+	'ί': 'Ι', 'Ί': 'Ι',
+	'ό': 'Ο', 'Ό': 'Ο',
+	'ύ': 'Υ', 'Ύ': 'Υ',
+	'ώ': 'Ω', 'Ώ': 'Ω',
+	'ΐ': 'Ϊ', 'ΰ': 'Ϋ',
+}
+
+// upperRune returns the uppercase form of r, which may be several runes.
+func upperRune(r rune, lang Lang) string {
+	switch lang {
+	case LangTurkish:
+		return string(unicode.TurkishCase.ToUpper(r))
+	case LangGreek:
+		if base, ok := greekUpperNoAccent[r]; ok {
+			return string(base)
+		}
+	}
+	if s, ok := specialUpper[r]; ok {
+		return s
+	}
+	return string(unicode.ToUpper(r))
+}
+
+// titleRune returns the titlecase form of r, used for the first letter
+// of a capitalized word. Digraphs like ǆ become ǅ rather than Ǆ.
+func titleRune(r rune, lang Lang) string {
+	if lang == LangTurkish {
+		return string(unicode.TurkishCase.ToTitle(r))
+	}
+	if s, ok := specialTitle[r]; ok {
+		return s
+	}
+	return string(unicode.ToTitle(r))
+}
+
+// lowerRune returns the lowercase form of runes[i]. A capital sigma at
+// the end of a word becomes the final form ς.
+func lowerRune(runes []rune, i int, lang Lang) string {
+	r := runes[i]
+	if r == 'Σ' && isFinalSigma(runes, i) {
+		return "ς"
+	}
+	if lang == LangTurkish {
+		return string(unicode.TurkishCase.ToLower(r))
+	}
+	return string(unicode.ToLower(r))
+}
+
+// isFinalSigma reports whether the sigma at runes[i] ends a word:
+// it follows a letter and is not followed by one.
+func isFinalSigma(runes []rune, i int) bool {
+	if i == 0 || !unicode.IsLetter(runes[i-1]) {
+		return false
+	}
+	return i+1 >= len(runes) || !unicode.IsLetter(runes[i+1])
+}
+
+// ToUpper returns s in uppercase using the casing rules of lang.
+func ToUpper(s string, lang Lang) string {
+	var b strings.Builder
+	for _, r := range s {
+		b.WriteString(upperRune(r, lang))
+	}
+	return b.String()
+}
+
+// ToLower returns s in lowercase using the casing rules of lang.
+func ToLower(s string, lang Lang) string {
+	var b strings.Builder
+	runes := []rune(s)
+	for i := range runes {
+		b.WriteString(lowerRune(runes, i, lang))
+	}
+	return b.String()
+}
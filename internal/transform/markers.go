@@ -0,0 +1,277 @@
+package transform
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Marker is a parsed marker token such as (up, 2) or (cap:start, mode=keep).
+//
+// Grammar (whitespace is allowed around every element):
+//
+//	marker = "(" name [ ":" phase ] [ arg { [ "," ] arg } ] ")"
+//	arg    = value | key "=" value
+//	value  = number | word
+//	number = [ "+" | "-" ] digit { digit }
+//	name, phase, key, word = letter { letter | digit | "_" | "-" }
+//
+// The first argument may be separated from the name by a comma or by
+// whitespace alone, so (up, 2), (up,2) and (up 2) are the same marker.
+// Names, phases, keys and word values are case-insensitive and are
+// stored in lowercase: (UP) and ( up ) both parse as Name "up".
+//
+// ParseMarker only checks the syntax; each transform decides which
+// names and arguments it accepts, and keeps anything else as literal text.
+type Marker struct {
+	Name string
+	// Phase is "start" or "end" for range markers like (up:start),
+	// and empty otherwise.
+	Phase string
+	Args  []MarkerArg
+}
+
+// MarkerArg is one marker argument. Key is empty for positional
+// arguments like the 2 in (up, 2) and set for named ones like count=2.
+type MarkerArg struct {
+	Key   string
+	Value string
+}
+
+// IsNumber reports whether the argument value is a signed integer.
+func (a MarkerArg) IsNumber() bool {
+	digits := strings.TrimLeft(a.Value, "+-")
+	if digits == "" || len(a.Value)-len(digits) > 1 {
+		return false
+	}
+	for _, r := range digits {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseMarker parses a marker token according to the Marker grammar.
+// It returns false when the token is not a well-formed marker.
+func ParseMarker(token string) (Marker, bool) {
+	// fast path for the common case of an ordinary word
+	if strings.IndexByte(token, '(') < 0 {
+		return Marker{}, false
+	}
+	p := markerParser{src: token}
+	return p.parse()
+}
+
+// markerParser is a small recursive-descent parser over a marker token.
+type markerParser struct {
+	src string
+	pos int
+}
+
+func (p *markerParser) parse() (Marker, bool) {
+	var m Marker
+	if !p.accept('(') {
+		return m, false
+	}
+	name, ok := p.word()
+	if !ok {
+		return m, false
+	}
+	m.Name = name
+	if p.accept(':') {
+		if m.Phase, ok = p.word(); !ok {
+			return m, false
+		}
+	}
+
+	for !p.accept(')') {
+		if p.pos >= len(p.src) {
+			return m, false
+		}
+		// a separating comma is optional, but must be followed by an argument
+		comma := p.accept(',')
+		if !comma && len(m.Args) == 0 && !p.spaceBefore() {
+			return m, false
+		}
+		arg, ok := p.arg()
+		if !ok {
+			return m, false
+		}
+		m.Args = append(m.Args, arg)
+	}
+	p.skipSpace()
+	return m, p.pos == len(p.src)
+}
+
+// arg parses a positional value or a key=value pair.
+func (p *markerParser) arg() (MarkerArg, bool) {
+	if num, ok := p.number(); ok {
+		return MarkerArg{Value: num}, true
+	}
+	word, ok := p.word()
+	if !ok {
+		return MarkerArg{}, false
+	}
+	if !p.accept('=') {
+		return MarkerArg{Value: word}, true
+	}
+	if num, ok := p.number(); ok {
+		return MarkerArg{Key: word, Value: num}, true
+	}
+	value, ok := p.word()
+	return MarkerArg{Key: word, Value: value}, ok
+}
+
+// skipSpace advances past whitespace.
+func (p *markerParser) skipSpace() {
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		if !unicode.IsSpace(r) {
+			return
+		}
+		p.pos += size
+	}
+}
+
+// spaceBefore reports whether whitespace precedes the current position.
+func (p *markerParser) spaceBefore() bool {
+	r, _ := utf8.DecodeLastRuneInString(p.src[:p.pos])
+	return unicode.IsSpace(r)
+}
+
+// accept skips whitespace and consumes the delimiter c if it comes next.
+func (p *markerParser) accept(c byte) bool {
+	p.skipSpace()
+	if p.pos < len(p.src) && p.src[p.pos] == c {
+		p.pos++
+		p.skipSpace()
+		return true
+	}
+	return false
+}
+
+// word consumes a name-like word and returns it in lowercase.
+func (p *markerParser) word() (string, bool) {
+	p.skipSpace()
+	start := p.pos
+	for p.pos < len(p.src) {
+		r, size := utf8.DecodeRuneInString(p.src[p.pos:])
+		first := p.pos == start
+		if !unicode.IsLetter(r) && (first || !(unicode.IsDigit(r) || r == '_' || r == '-')) {
+			break
+		}
+		p.pos += size
+	}
+	if p.pos == start {
+		return "", false
+	}
+	return strings.ToLower(p.src[start:p.pos]), true
+}
+
+// number consumes an optionally signed integer.
+func (p *markerParser) number() (string, bool) {
+	p.skipSpace()
+	start := p.pos
+	if p.pos < len(p.src) && (p.src[p.pos] == '+' || p.src[p.pos] == '-') {
+		p.pos++
+	}
+	digits := p.pos
+	for p.pos < len(p.src) && p.src[p.pos] >= '0' && p.src[p.pos] <= '9' {
+		p.pos++
+	}
+	if p.pos == digits {
+		p.pos = start
+		return "", false
+	}
+	return p.src[start:p.pos], true
+}
+
+// IsMarker reports whether the token is a marker handled by one of the
+// transforms, as opposed to ordinary text in parentheses like (see above)
+// or (up a hill). Markers with arguments a marker can take but not this
+// one, such as (up, -1) or (hex, 2), still count, and so does text that
+// only looks like one, such as (up, ) or (up, 2, extra): the transform
+// keeps them as literal text.
+func IsMarker(token string) bool {
+	name, ok := markerName(token)
+	if !ok {
+		return false
+	}
+	if name == "hex" || name == "bin" {
+		return true
+	}
+	_, ok = caseMarkers[name]
+	return ok
+}
+
+// markerName returns the name of a marker token, see IsMarker. It
+// returns false for prose in parentheses.
+func markerName(token string) (string, bool) {
+	m, ok := ParseMarker(token)
+	if ok && hasMarkerArgs(m) {
+		return m.Name, true
+	}
+	return malformedMarkerName(token)
+}
+
+// malformedMarkerName returns the name of a token that looks like a
+// marker but is not a valid one: a name followed by a comma, a colon, a
+// number or the closing parenthesis, as in (up, ) or (up, 2, extra).
+// A name followed by a word, as in (up a hill), is prose.
+func malformedMarkerName(token string) (string, bool) {
+	if !strings.HasSuffix(token, ")") || strings.Count(token, "(") != 1 {
+		return "", false
+	}
+	p := markerParser{src: token}
+	if !p.accept('(') {
+		return "", false
+	}
+	name, ok := p.word()
+	if !ok {
+		return "", false
+	}
+	p.skipSpace()
+	switch c := p.src[p.pos]; {
+	case c == ',' || c == ':' || c == ')' || c == '+' || c == '-' || ('0' <= c && c <= '9'):
+		return name, true
+	}
+	return "", false
+}
+
+// hasMarkerArgs reports whether every argument of m is one a marker can
+// take: a count, the quote scope, a (cap) mode, or a count=, scope= or
+// mode= argument. Prose in parentheses, like (low and slow), parses as a
+// marker too, but its words are none of these.
+func hasMarkerArgs(m Marker) bool {
+	for _, arg := range m.Args {
+		switch arg.Key {
+		case "count", "scope", "mode":
+		case "":
+			_, mode := capitalizeModes[arg.Value]
+			if !arg.IsNumber() && arg.Value != "quote" && !mode {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// Unescape removes the backslash that keeps a parenthesis from starting a
+// marker, so \(up) in the input is written out as the literal text (up).
+// Backslashes anywhere else are left alone; \\( yields \(.
+func Unescape(text string) string {
+	if !strings.Contains(text, "\\") {
+		return text
+	}
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) && (text[i+1] == '(' || text[i+1] == ')') {
+			continue
+		}
+		b.WriteByte(text[i])
+	}
+	return b.String()
+}
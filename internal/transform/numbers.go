@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"strconv"
 	"strings"
+	"unicode/utf8"
 )
 
 const (
@@ -25,57 +26,107 @@ const (
 //
 // Input tokens: ["1111", "(bin),", "add", "1E", "(hex)."]
 // Output:       ["15", "add", "30", "."]
+//
+// Markers chain: a second marker converts the number the first one wrote,
+// so "15 (hex) (hex)" gives 33 rather than "21 (hex)", which the next run
+// would convert.
 func ConvertHexAndBin(words []string) []string {
-	var result []string
-
-	for i := 0; i < len(words); i++ {
-		word := words[i]
-
-		// Defensive check: look ahead to the next token if available
-		if i+1 < len(words) {
-			// Trim possible trailing punctuation and quotes from the next token
-			next := strings.Trim(words[i+1], ".,!?;:\"'")
+	return ConvertHexAndBinWithMarkers(words, nil)
+}
 
-			switch next {
-			case "(hex)":
-				// Strip quotes for parsing, but preserve them in output
-				cleanWord := strings.Trim(word, "\"'")
-				prefix := strings.TrimSuffix(word, cleanWord)
-				suffix := strings.TrimPrefix(word, prefix+cleanWord)
+// ConvertHexAndBinWithMarkers is ConvertHexAndBin that also looks back
+// past custom markers, so "1E (em) (hex)" converts like "1E (cap) (hex)".
+func ConvertHexAndBinWithMarkers(words []string, markers CustomMarkers) []string {
+	result := make([]string, 0, len(words))
 
-				// Attempt hexadecimal conversion
-				value, err := strconv.ParseInt(cleanWord, BaseHexadecimal, 64)
-				if err == nil {
-					// Successfully converted - preserve any quotes around the converted number
-					result = append(result, prefix+fmt.Sprintf("%d", value)+suffix)
-					i++ // skip the "(hex)" token
-					continue
-				}
-				// If conversion failed, keep both word and marker unchanged
-				// Fall through to append word normally (marker will be added in next iteration)
+	for _, word := range words {
+		if strings.IndexByte(word, '(') < 0 {
+			// Normal word (not a number marker)
+			result = append(result, word)
+			continue
+		}
 
-			case "(bin)":
-				// Strip quotes for parsing, but preserve them in output
-				cleanWord := strings.Trim(word, "\"'")
-				prefix := strings.TrimSuffix(word, cleanWord)
-				suffix := strings.TrimPrefix(word, prefix+cleanWord)
+		// Trim possible trailing punctuation and quotes from the marker
+		base := BaseHexadecimal
+		switch numberMarker(strings.Trim(word, ".,!?;:"+quoteChars)) {
+		case "hex":
+		case "bin":
+			base = BaseBinary
+		default:
+			// Normal word (not a number marker)
+			result = append(result, word)
+			continue
+		}
 
-				// Attempt binary conversion
-				value, err := strconv.ParseInt(cleanWord, BaseBinary, 64)
-				if err == nil {
-					// Successfully converted - preserve any quotes around the converted number
-					result = append(result, prefix+fmt.Sprintf("%d", value)+suffix)
-					i++ // skip the "(bin)" token
-					continue
-				}
-				// If conversion failed, keep both word and marker unchanged
-				// Fall through to append word normally (marker will be added in next iteration)
-			}
+		// Look back past other markers, so "1E (cap) (hex)" converts too,
+		// and past a closing quote split off the number. A number marker
+		// still in result failed to convert and stays as literal text.
+		j := len(result) - 1
+		for j >= 0 && (isLaterMarker(result[j], markers) || strings.Trim(result[j], quoteChars) == "") {
+			j--
+		}
+		if j < 0 {
+			result = append(result, word)
+			continue
 		}
 
-		// Normal word (not followed by a marker)
-		result = append(result, word)
+		// Strip quotes for parsing, but preserve them in output. The number
+		// follows the last quote, so in 0"1E only 1E converts: FixQuotes
+		// later splits the opening quote off the 0.
+		prev := result[j]
+		body := strings.TrimRight(prev, quoteChars)
+		q := strings.LastIndexAny(body, quoteChars)
+		k := 0
+		if q >= 0 {
+			_, size := utf8.DecodeRuneInString(body[q:])
+			k = q + size
+		}
+		value, err := strconv.ParseInt(body[k:], base, 64)
+		if err != nil || isApostrophe(body, q) {
+			// If conversion failed, keep both word and marker unchanged
+			result = append(result, word)
+			continue
+		}
+		// Successfully converted - preserve any quotes around the converted
+		// number and drop the marker
+		result[j] = prev[:k] + fmt.Sprintf("%d", value) + prev[len(body):]
 	}
 
 	return result
 }
+
+// numberMarker returns "hex" or "bin" when the token is that marker
+// without arguments, such as (hex) or ( HEX ), and "" otherwise.
+func numberMarker(token string) string {
+	m, ok := ParseMarker(token)
+	if !ok || m.Phase != "" || len(m.Args) > 0 {
+		return ""
+	}
+	return m.Name
+}
+
+// isLaterMarker reports whether the token is a marker that a later stage
+// applies, custom markers included, as opposed to a number marker kept
+// as literal text.
+func isLaterMarker(token string, markers CustomMarkers) bool {
+	if markers.IsMarker(token) {
+		return true
+	}
+	name, _ := markerName(token)
+	return IsMarker(token) && name != "hex" && name != "bin"
+}
+
+// isApostrophe reports whether the rune at word[i] is a single quote
+// between two letters or digits, as in don't, rather than a quote.
+func isApostrophe(word string, i int) bool {
+	if i < 0 {
+		return false
+	}
+	r, size := utf8.DecodeRuneInString(word[i:])
+	if r != '\'' && r != '’' {
+		return false
+	}
+	prev, _ := utf8.DecodeLastRuneInString(word[:i])
+	next, _ := utf8.DecodeRuneInString(word[i+size:])
+	return isWordRune(prev) && isWordRune(next)
+}
@@ -1,68 +1,274 @@
 package transform
 
 import (
-	"bytes"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 )
 
-// ApplyPunctuationRules fixes spacing for . , ! ? : ; according to the spec.
+// PunctClass describes how a punctuation mark is spaced.
+type PunctClass int
+
+const (
+	// NotPunct marks runes that are not punctuation, e.g. letters.
+	NotPunct PunctClass = iota
+	// AttachLeft marks are written right after the previous word and
+	// followed by a space: "word ." → "word." and ",word" → ", word".
+	AttachLeft
+	// AttachRight marks are written right before the next word:
+	// "¿ qué" → "¿qué".
+	AttachRight
+	// Surround marks get one space on each side: "word —word" → "word — word".
+	Surround
+	// NoSpace marks join the words around them: "and / or" → "and/or".
+	NoSpace
+)
+
+// PunctuationClasses maps punctuation marks to their spacing class.
+// The tokenizer splits words at every mark in the map.
+type PunctuationClasses map[rune]PunctClass
+
+// DefaultPunctuation returns the standard punctuation classes:
+//   - attach-left: . , ! ? : ; … % ) ] }
+//   - attach-right: ¿ ¡ [ {
+//   - surround: — (em dash) and – (en dash)
+//
+// No mark is NoSpace by default. The result is a new map the caller may
+// change, e.g. to add '/' as NoSpace.
+func DefaultPunctuation() PunctuationClasses {
+	return PunctuationClasses{
+		'.': AttachLeft, ',': AttachLeft, '!': AttachLeft, '?': AttachLeft,
+		':': AttachLeft, ';': AttachLeft, '…': AttachLeft, '%': AttachLeft,
+		')': AttachLeft, ']': AttachLeft, '}': AttachLeft,
+		'¿': AttachRight, '¡': AttachRight, '[': AttachRight, '{': AttachRight,
+		'—': Surround, '–': Surround,
+	}
+}
+
+// defaultPunct is DefaultPunctuation with an array for ASCII lookups.
+var defaultPunct = newPunctTable(DefaultPunctuation())
+
+type punctTable struct {
+	ascii [utf8.RuneSelf]PunctClass
+	other PunctuationClasses
+}
+
+func newPunctTable(c PunctuationClasses) *punctTable {
+	t := &punctTable{other: make(PunctuationClasses)}
+	for r, class := range c {
+		if r >= 0 && r < utf8.RuneSelf {
+			t.ascii[r] = class
+		} else {
+			t.other[r] = class
+		}
+	}
+	return t
+}
+
+// Class returns the class of r. A nil map means DefaultPunctuation.
+func (c PunctuationClasses) Class(r rune) PunctClass {
+	if c != nil {
+		return c[r]
+	}
+	if r >= 0 && r < utf8.RuneSelf {
+		return defaultPunct.ascii[r]
+	}
+	return defaultPunct.other[r]
+}
+
+// IsPunctuation reports whether r is a punctuation mark of any class,
+// which the tokenizer splits into a token of its own.
+func (c PunctuationClasses) IsPunctuation(r rune) bool {
+	return c.Class(r) != NotPunct
+}
+
+// ApplyPunctuationRules fixes the spacing of punctuation marks according
+// to DefaultPunctuation.
 //
 // Rules implemented:
-// 1) Remove spaces before punctuation (. , ! ? : ;)
-// 2) Add one space after punctuation if next is a letter, digit, quote, or '('
+// 1) Remove spaces before attach-left punctuation (. , ! ? : ; … % ) ] })
+// 2) Add one space after it if next is a letter, digit, quote, '(' or
+// attach-right punctuation
 // 3) Treat multi-punctuation groups (..., !!, !?, etc.) as one unit
-// 4) Never add or remove spaces around parentheses except when '(' follows punctuation
+// 4) Remove spaces after attach-right punctuation (¿ ¡ [ {), put exactly
+// one space on each side of surround punctuation (— –), and remove the
+// spaces on both sides of no-space punctuation
+// 5) Leave marker-shaped text such as (up:start) untouched: a '(' directly
+// followed by a non-space opens a span copied as-is up to its ')'
+// 6) Remove spaces just inside other parentheses: "( see above )" → "(see above)"
 //
 // Example:
 // Input:  "I was sitting over there ,and then BAMM !!"
 // Output: "I was sitting over there, and then BAMM!!"
 func ApplyPunctuationRules(text string) string {
-	var b bytes.Buffer
-	runes := []rune(text)
-	length := len(runes)
-
-	for i := 0; i < length; i++ {
-		r := runes[i]
-
-		// --- Rule 1: remove spaces before punctuation
-		if unicode.IsSpace(r) && i+1 < length {
-			next := runes[i+1]
-			if strings.ContainsRune(".,!?;:", next) {
-				continue // skip writing this space
+	return ApplyPunctuationRulesWithClasses(text, nil)
+}
+
+// ApplyPunctuationRulesWithClasses is ApplyPunctuationRules with custom
+// punctuation classes. A nil map means DefaultPunctuation.
+//
+// Example, with '/' added as NoSpace:
+//
+//	Input:  "¿ qué ? and / or"
+//	Output: "¿qué? and/or"
+func ApplyPunctuationRulesWithClasses(text string, classes PunctuationClasses) string {
+	return ApplyPunctuationRulesWithProfile(text, SpacingProfile{Punctuation: classes})
+}
+
+// ApplyPunctuationRulesWithProfile is ApplyPunctuationRules with the
+// punctuation classes and fixed spaces of a language profile, see
+// SpacingFor.
+//
+// Example, with SpacingFor(LangFrench):
+//
+//	Input:  "Quoi ?Vraiment !"
+//	Output: "Quoi\u202f? Vraiment\u202f!"
+func ApplyPunctuationRulesWithProfile(text string, profile SpacingProfile) string {
+	classes := profile.Punctuation
+	w := spaceWriter{lineStart: true}
+	w.b.Grow(len(text))
+
+	inMarker := false
+	inGroup := false // the previous rune was attach-left punctuation
+
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		// next is the rune after r, or -1 at the end of the text
+		next, nextSize := rune(-1), 0
+		if i < len(text) {
+			next, nextSize = utf8.DecodeRuneInString(text[i:])
+		}
+		// skipSpaces drops the whitespace after r
+		skipSpaces := func() {
+			for next >= 0 && isSpace(next) {
+				i += nextSize
+				next, nextSize = -1, 0
+				if i < len(text) {
+					next, nextSize = utf8.DecodeRuneInString(text[i:])
+				}
+			}
+		}
+
+		// --- Rule 5: copy marker-shaped spans verbatim
+		if r == '(' && next >= 0 && !isSpace(next) {
+			inMarker = true
+		}
+		if inMarker {
+			if isSpace(r) && r != '\n' {
+				w.writeFixed(r)
+			} else {
+				w.writeRune(r)
 			}
+			inMarker = r != ')'
+			continue
 		}
 
-		// --- Write current rune
-		b.WriteString(string(r))
+		// --- Rule 6: remove spaces just inside parentheses
+		if r == '(' {
+			w.writeRune(r)
+			skipSpaces()
+			continue
+		}
+		if r == ')' {
+			w.pendingSpace = false
+		}
 
-		// --- Rule 3: detect punctuation groups (like ... or !?)
-		if strings.ContainsRune(".,!?;:", r) {
-			// Peek ahead to see if next is punctuation too
-			if i+1 < length && strings.ContainsRune(".,!?;:", runes[i+1]) {
-				// Don't insert space yet — still inside group
+		nextClass := classes.Class(next)
+		class := classes.Class(r)
+		wasInGroup := inGroup
+		if !isSpace(r) {
+			// spaces inside a group like "? !" are removed below
+			inGroup = class == AttachLeft
+		}
+		switch class {
+		case AttachLeft:
+			// --- Rule 1: remove spaces before punctuation, or put the
+			// profile's fixed space before the group
+			w.pendingSpace = false
+			if space, ok := profile.SpaceBefore[r]; ok && !wasInGroup && !w.lineStart {
+				w.writeFixed(space)
+			}
+			w.writeRune(r)
+
+			// --- Rule 3: still inside a group (like ... or !?), no space yet
+			if nextClass == AttachLeft {
 				continue
 			}
+			// --- Rule 2: add a space after punctuation if next is word, quote, '(' or ¿
+			if unicode.IsLetter(next) || unicode.IsDigit(next) || next == '"' || next == '\'' || next == '(' ||
+				nextClass == AttachRight {
+				w.writeRune(' ')
+			}
 
-			// --- Rule 2: add a space after punctuation if next is word, quote, or '('
-			if i+1 < length {
-				next := runes[i+1]
-				if unicode.IsLetter(next) || unicode.IsDigit(next) || next == '"' || next == '\'' || next == '(' {
-					b.WriteByte(' ')
-				}
+		// --- Rule 4: the other classes
+		case AttachRight:
+			w.writeRune(r)
+			skipSpaces()
+		case Surround:
+			w.writeRune(' ')
+			w.writeRune(r)
+			skipSpaces()
+			w.writeRune(' ')
+		case NoSpace:
+			w.pendingSpace = false
+			w.writeRune(r)
+			skipSpaces()
+
+		default:
+			// --- Rule 1: a space directly before punctuation is skipped
+			if isSpace(r) && (nextClass == AttachLeft || nextClass == NoSpace) {
+				continue
 			}
+			w.writeRune(r)
+		}
+	}
+
+	return strings.TrimSpace(w.b.String())
+}
+
+// spaceWriter builds the output of ApplyPunctuationRules while keeping
+// line breaks and normalizing spaces within each line: runs of whitespace
+// collapse to one space, and spaces at the start and end of a line are
+// dropped.
+type spaceWriter struct {
+	b            strings.Builder
+	pendingSpace bool // whitespace seen since the last rune written
+	lineStart    bool // nothing but whitespace written on this line yet
+}
+
+// writeFixed writes the space r as is, where writeRune would normalize it.
+func (w *spaceWriter) writeFixed(r rune) {
+	w.b.WriteRune(r)
+	w.pendingSpace = false
+}
+
+func (w *spaceWriter) writeRune(r rune) {
+	switch {
+	case r == '\n':
+		w.b.WriteByte('\n')
+		w.pendingSpace = false
+		w.lineStart = true
+	case isSpace(r):
+		w.pendingSpace = !w.lineStart
+	default:
+		if w.pendingSpace {
+			w.b.WriteByte(' ')
+			w.pendingSpace = false
+		}
+		if r < utf8.RuneSelf {
+			w.b.WriteByte(byte(r))
+		} else {
+			w.b.WriteRune(r)
 		}
+		w.lineStart = false
 	}
+}
 
-	// Preserve line breaks while normalizing spaces within each line.
-	// We avoid a global strings.Fields to keep '\n' structure intact.
-	built := b.String()
-	lines := strings.Split(built, "\n")
-	for i := range lines {
-		// Collapse runs of whitespace on each line to single spaces
-		// (leading/trailing spaces on the line are trimmed by Fields).
-		lines[i] = strings.Join(strings.Fields(lines[i]), " ")
+// isSpace is unicode.IsSpace with a fast path for ASCII.
+func isSpace(r rune) bool {
+	if r < utf8.RuneSelf {
+		return r == ' ' || ('\t' <= r && r <= '\r')
 	}
-	out := strings.Join(lines, "\n")
-	return strings.TrimSpace(out)
+	return unicode.IsSpace(r)
 }
@@ -2,9 +2,13 @@ package transform
 
 import (
 	"bytes"
+	"fmt"
+	"sort"
 	"strings"
 	"unicode"
 	"unicode/utf8"
+
+	"go-reloaded/internal/diag"
 )
 
 // FixQuotes cleans spacing around both "double" and "single" quotation marks
@@ -13,6 +17,8 @@ import (
 // 1) Keep one space before an opening quote if there was any space before it.
 //   - If multiple spaces exist before the opening quote, collapse them to exactly one.
 //   - We do not delete the single space before the opening quote.
+//   - An opening quote glued to the previous word gets a space before it when
+//     the word inside follows, so it does not turn into an apostrophe.
 //
 // 2) Remove spaces immediately inside quotes:
 //   - After opening quote.
@@ -21,93 +27,389 @@ import (
 // 3) After a closing quote, insert one space if the next rune is a letter, a digit or '('.
 //   - Do not insert a space if the next rune is punctuation (.,!?:;) or whitespace
 //
-// 4) Handles both " and ' quotes, and only closes with the same quote type opened
-// 5) Unicode safe: uses utf8.DecodeLastRuneInString + Builder. for in-place trimming.
+// 4) Handles both " and ' quotes, and only closes with the same quote type opened.
+//   - Quotes nest: in "he said 'hi' to me" the single quotes pair up inside the
+//     double ones. A quote left open inside is closed along with the outer one.
+//
+// 5) Unicode safe: scans the UTF-8 text in place and trims the output buffer with
+// utf8.DecodeLastRune.
+// 6) Guillemets (« ») follow rules 1-3 as well; they are directional, so
+// they never pair up with the other quotes.
+// 7) Apostrophes are kept as they are, see IsApostrophe: inside words (don't),
+// in elisions ('90s, 'til, goin') and after plural possessives (the students' books).
 func FixQuotes(text string) string {
-	var b bytes.Buffer // Efficient builder for UTF-8 bytes
-	inQuotes := false
-	var quoteType rune // Tracks opening quote type
+	return FixQuotesWithProfile(text, SpacingFor(LangDefault))
+}
 
-	runes := []rune(text)
+// FixQuotesWithProfile is FixQuotes with the guillemets of a language
+// profile, see SpacingFor. French puts a no-break space inside them:
+//
+//	Input:  "il a dit « oui »"
+//	Output: "il a dit «\u00a0oui\u00a0»"
+func FixQuotesWithProfile(text string, profile SpacingProfile) string {
+	return FixQuotesWithState(text, profile, QuoteState{})
+}
 
-	for i := 0; i < len(runes); i++ {
-		ch := runes[i]
+// FixQuotesWithState is FixQuotesWithProfile for one line of a document,
+// starting with the quotes MatchQuotes found open at the start of the
+// line, so a quotation that began on an earlier line is closed here.
+func FixQuotesWithState(text string, profile SpacingProfile, state QuoteState) string {
+	if !strings.ContainsAny(text, quoteChars) {
+		return strings.TrimSpace(text)
+	}
 
-		// Treat apostrophes inside words as literal, not as quotes
-		if (ch == '\'' || ch == '’') && i-1 >= 0 && i+1 < len(runes) &&
-			(unicode.IsLetter(runes[i-1]) || unicode.IsDigit(runes[i-1])) &&
-			(unicode.IsLetter(runes[i+1]) || unicode.IsDigit(runes[i+1])) {
-			b.WriteRune(ch)
-			continue
-		}
+	var b bytes.Buffer // Efficient builder for UTF-8 bytes
+	b.Grow(len(text) + 8)
+	var stack [8]openQuote
+	s := quoteScanner{profile: profile, open: append(stack[:0], state.open...)}
 
-		// Handle quote characters (straight and curly)
-		if ch == '"' || ch == '\'' || ch == '“' || ch == '”' || ch == '‘' || ch == '’' {
-			// Normalize curly quotes to straight for consistency in spacing rules
-			isSingle := (ch == '\'' || ch == '‘' || ch == '’')
-			normalized := ch
-			if ch == '“' || ch == '”' {
-				normalized = '"'
-			}
-			if ch == '‘' || ch == '’' {
-				normalized = '\''
-			}
+	for i := 0; i < len(text); {
+		ch, size := utf8.DecodeRuneInString(text[i:])
+		m, _ := s.next(text, i, 0)
+		i += size
+		next, nextSize := utf8.DecodeRuneInString(text[i:])
 
-			if !inQuotes {
+		switch m.role {
+		case openingQuote, reopeningQuote:
+			if m.guillemet {
+				// Guillemets: collapse the spaces outside, fix the ones inside
+				if trimTrailingSpace(&b) > 0 {
+					b.WriteRune(' ')
+				}
+				b.WriteRune(ch)
+				if profile.GuillemetSpace != 0 {
+					b.WriteRune(profile.GuillemetSpace)
+				}
+			} else {
 				// Collapse multiple spaces before opening quote to exactly one
 				if b.Len() > 0 {
-					trailingSpaces := 0
-					for b.Len() > 0 {
-						r, size := utf8.DecodeLastRune(b.Bytes())
-						if size == 0 || !unicode.IsSpace(r) {
-							break
-						}
-						trailingSpaces++
-						b.Truncate(b.Len() - size)
-					}
-					if trailingSpaces > 0 {
+					trailingSpaces := trimTrailingSpace(&b)
+					if trailingSpaces > 0 || gluedOpeningQuote(b.Bytes(), text[i:]) {
 						b.WriteRune(' ')
 					}
 				}
-
-				b.WriteRune(normalized)
-				inQuotes = true
-				quoteType = normalized
-
-				// Remove spaces immediately after opening quote
-				for i+1 < len(runes) && unicode.IsSpace(runes[i+1]) {
-					i++
+				// Curly quotes are normalized to straight ones
+				b.WriteRune(m.kind)
+			}
+			// Remove spaces immediately after opening quote
+			for i < len(text) {
+				r, size := utf8.DecodeRuneInString(text[i:])
+				if !unicode.IsSpace(r) {
+					break
 				}
-				continue
+				i += size
 			}
 
-			// Closing quote (match type)
-			if inQuotes && ((isSingle && quoteType == '\'') || (!isSingle && quoteType == '"')) {
-				// Remove spaces before closing quote
-				for b.Len() > 0 {
-					r, size := utf8.DecodeLastRune(b.Bytes())
-					if size == 0 || !unicode.IsSpace(r) {
-						break
-					}
-					b.Truncate(b.Len() - size)
+		case closingQuote:
+			// Remove spaces before closing quote
+			trimTrailingSpace(&b)
+			if m.guillemet {
+				if profile.GuillemetSpace != 0 {
+					b.WriteRune(profile.GuillemetSpace)
 				}
+				b.WriteRune(ch)
+			} else {
+				b.WriteRune(m.kind)
+			}
+			// Add a space after closing quote if followed by a letter/digit or '('
+			if nextSize > 0 && (unicode.IsLetter(next) || unicode.IsDigit(next) || next == '(') {
+				b.WriteRune(' ')
+			}
+
+		default:
+			// Apostrophes and anything else: copy as-is
+			b.WriteRune(ch)
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
 
-				b.WriteRune(quoteType)
-				inQuotes = false
+// QuoteState holds the quotes still open at the start of a line, as found
+// by MatchQuotes. The zero value has no open quotes.
+type QuoteState struct {
+	open []openQuote
+}
 
-				// Add a space after closing quote if followed by a letter/digit or '('
-				if i+1 < len(runes) {
-					next := runes[i+1]
-					if unicode.IsLetter(next) || unicode.IsDigit(next) || next == '(' {
-						b.WriteRune(' ')
-					}
+// openQuote is a quote waiting for its closing quote.
+type openQuote struct {
+	kind rune // " or ' (see quoteKind) or the opening guillemet
+	mark rune // the quote as written, e.g. '“'
+	line int  // 1-based line, for diagnostics
+}
+
+// quoteRole is what a quote mark does at its position in the text.
+type quoteRole int
+
+const (
+	notQuote       quoteRole = iota // an apostrophe, or not a quote at all
+	openingQuote                    // pushed on the stack of open quotes
+	closingQuote                    // closes the innermost open quote of its kind
+	reopeningQuote                  // starts a new paragraph of a quotation still open
+	strayQuote                      // a closing guillemet with nothing to close
+)
+
+// quoteMark is a classified quote mark.
+type quoteMark struct {
+	role      quoteRole
+	kind      rune
+	guillemet bool
+}
+
+// quoteKind classifies the rune at text[i:]; singleOpen tells whether a
+// single quote is open, see IsApostrophe. kind is " or ' for straight and curly quotes, the opening
+// guillemet of the profile for both guillemets, and 0 for anything else,
+// including apostrophes. dir is 1 for an opening guillemet, -1 for a
+// closing one and 0 for the quotes that can do either.
+func quoteKind(text string, i int, profile SpacingProfile, singleOpen bool) (kind rune, dir int) {
+	ch, _ := utf8.DecodeRuneInString(text[i:])
+	opening, closing := profile.Guillemets[0], profile.Guillemets[1]
+	switch {
+	case ch == opening && opening != 0:
+		return opening, 1
+	case ch == closing && closing != 0:
+		return opening, -1
+	case ch == '"' || ch == '“' || ch == '”':
+		return '"', 0
+	case !isSingleQuote(ch):
+		return 0, 0
+	}
+
+	if IsApostrophe(text, i, singleOpen) {
+		return 0, 0
+	}
+	return '\'', 0
+}
+
+// quoteScanner pairs quotes with a stack of open quotes, so quotes of one
+// kind can nest inside another, as in "he said 'hi' to me".
+type quoteScanner struct {
+	profile SpacingProfile
+	open    []openQuote
+}
+
+// next classifies the quote mark at text[i:], if any, and updates the
+// open quotes. A quote closes the innermost open quote of its kind; any
+// quotes opened inside that one are closed with it and returned as
+// unclosed. They share memory with the scanner, so use them before the
+// next call.
+func (s *quoteScanner) next(text string, i int, line int) (m quoteMark, unclosed []openQuote) {
+	kind, dir := quoteKind(text, i, s.profile, s.isOpen('\''))
+	if kind == 0 {
+		return quoteMark{}, nil
+	}
+	m = quoteMark{kind: kind, guillemet: dir != 0}
+
+	idx := len(s.open) - 1
+	for idx >= 0 && s.open[idx].kind != kind {
+		idx--
+	}
+	switch {
+	case idx >= 0 && dir >= 0 && isBlank(text[:i]):
+		// a quotation continued from an earlier line or paragraph
+		m.role = reopeningQuote
+	case dir > 0 || (dir == 0 && idx < 0):
+		mark, _ := utf8.DecodeRuneInString(text[i:])
+		s.open = append(s.open, openQuote{kind: kind, mark: mark, line: line})
+		m.role = openingQuote
+	case idx < 0:
+		m.role = strayQuote
+	default:
+		unclosed = s.open[idx+1:]
+		s.open = s.open[:idx]
+		m.role = closingQuote
+	}
+	return m, unclosed
+}
+
+// isOpen reports whether a quote of the kind is open.
+func (s *quoteScanner) isOpen(kind rune) bool {
+	for _, q := range s.open {
+		if q.kind == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// isBlank reports whether s holds only whitespace.
+func isBlank(s string) bool {
+	for _, r := range s {
+		if !unicode.IsSpace(r) {
+			return false
+		}
+	}
+	return true
+}
+
+// lineQuotes sums up the quotes of one kind in a line, for MatchQuotes to
+// decide whether a quotation continues there.
+type lineQuotes struct {
+	count  int  // quotes of the kind in the line
+	starts bool // the line starts with one
+	closes bool // one of them closes a quotation opened before the line
+}
+
+// quoteKinds are the kinds of quote MatchQuotes follows across lines.
+func quoteKinds(profile SpacingProfile) [3]rune {
+	return [3]rune{'"', '\'', profile.Guillemets[0]}
+}
+
+// kindIndex returns the index of kind in kinds, or -1.
+func kindIndex(kinds [3]rune, kind rune) int {
+	for k := range kinds {
+		if kind != 0 && kinds[k] == kind {
+			return k
+		}
+	}
+	return -1
+}
+
+// summarizeQuotes returns the lineQuotes of every kind in text.
+func summarizeQuotes(text string, profile SpacingProfile) [3]lineQuotes {
+	var sum [3]lineQuotes
+	var depth [3]int
+	kinds := quoteKinds(profile)
+	for i := range text {
+		// as seen from a quotation still open before the line
+		kind, dir := quoteKind(text, i, profile, true)
+		k := kindIndex(kinds, kind)
+		if k < 0 {
+			continue
+		}
+		if sum[k].count == 0 && isBlank(text[:i]) {
+			sum[k].starts = true
+		}
+		sum[k].count++
+		switch {
+		case dir > 0:
+			depth[k]++
+		case dir < 0 && depth[k] > 0:
+			depth[k]--
+		case dir < 0:
+			sum[k].closes = true
+		default:
+			// either quote can close, so an odd count leaves one to close
+			sum[k].closes = sum[k].count%2 == 1
+		}
+	}
+	return sum
+}
+
+// MatchQuotes pairs the quotes of a document, one line per element, the
+// way FixQuotesWithState does, and returns the quotes open at the start
+// of every line to pass to it, together with diagnostics for unbalanced
+// quotes.
+//
+// A quotation may go on over several lines. A quote still open at the end
+// of a line stays open if the next line with a quote of its kind starts
+// with one, as in dialogue that goes on over several paragraphs, or has
+// one to close it. Otherwise it is reported as never closed and dropped,
+// so a stray quote does not flip the pairing for the rest of the text.
+//
+// Example:
+//
+//	Input:  ["\"It was late,", "\"and dark.\"", "he said \"what"]
+//	Output: [{}, {"}, {}], with "line 3: quote \" is never closed"
+func MatchQuotes(lines []string, profile SpacingProfile) ([]QuoteState, []diag.Diagnostic) {
+	states := make([]QuoteState, len(lines))
+	var diags []diag.Diagnostic
+	unclosed := func(q openQuote) {
+		diags = append(diags, diag.Diagnostic{
+			Line:    q.line,
+			Message: fmt.Sprintf("quote %c is never closed", q.mark),
+		})
+	}
+
+	// nextQuote[k][i] is the first line after line i with a quote of kind k
+	kinds := quoteKinds(profile)
+	sums := make([][3]lineQuotes, len(lines))
+	var nextQuote [3][]int
+	for k := range kinds {
+		nextQuote[k] = make([]int, len(lines))
+	}
+	for i := len(lines) - 1; i >= 0; i-- {
+		if strings.ContainsAny(lines[i], quoteChars) {
+			sums[i] = summarizeQuotes(lines[i], profile)
+		}
+		for k := range kinds {
+			nextQuote[k][i] = -1
+			if i+1 < len(lines) {
+				nextQuote[k][i] = nextQuote[k][i+1]
+				if sums[i+1][k].count > 0 {
+					nextQuote[k][i] = i + 1
 				}
+			}
+		}
+	}
+
+	s := quoteScanner{profile: profile}
+	for li, line := range lines {
+		if len(s.open) > 0 {
+			states[li] = QuoteState{open: append([]openQuote(nil), s.open...)}
+		}
+		if strings.ContainsAny(line, quoteChars) {
+			for i := range line {
+				m, inner := s.next(line, i, li+1)
+				for _, q := range inner {
+					unclosed(q)
+				}
+				if m.role == strayQuote {
+					r, _ := utf8.DecodeRuneInString(line[i:])
+					diags = append(diags, diag.Diagnostic{
+						Line:    li + 1,
+						Message: fmt.Sprintf("closing quote %c has no opening quote", r),
+					})
+				}
+			}
+		}
+
+		// keep the quotes that continue on a later line
+		kept := s.open[:0]
+		for _, q := range s.open {
+			k := kindIndex(kinds, q.kind)
+			if j := nextQuote[k][li]; j >= 0 && (sums[j][k].starts || sums[j][k].closes) {
+				kept = append(kept, q)
 				continue
 			}
+			unclosed(q)
+		}
+		s.open = kept
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Line < diags[j].Line })
+	return states, diags
+}
+
+// quoteChars holds every rune FixQuotes treats as a quote.
+const quoteChars = "\"'“”‘’«»"
+
+// trimTrailingSpace removes the whitespace at the end of b and returns
+// how many runes it removed.
+func trimTrailingSpace(b *bytes.Buffer) int {
+	n := 0
+	for b.Len() > 0 {
+		r, size := utf8.DecodeLastRune(b.Bytes())
+		if size == 0 || !unicode.IsSpace(r) {
+			break
 		}
+		n++
+		b.Truncate(b.Len() - size)
+	}
+	return n
+}
 
-		// Default: copy character as-is
-		b.WriteRune(ch)
+// gluedOpeningQuote reports whether an opening quote directly after a letter
+// or digit would join two words once the spaces after it are removed, as in
+// "it' s": the output would read as an apostrophe on the next run.
+func gluedOpeningQuote(before []byte, after string) bool {
+	r, size := utf8.DecodeLastRune(before)
+	if size == 0 || !(unicode.IsLetter(r) || unicode.IsDigit(r)) {
+		return false
 	}
-	return strings.TrimSpace(b.String())
+	for _, next := range after {
+		if !unicode.IsSpace(next) {
+			return unicode.IsLetter(next) || unicode.IsDigit(next)
+		}
+	}
+	return false
 }
@@ -0,0 +1,246 @@
+package transform
+
+import (
+	"fmt"
+	"sort"
+
+	"go-reloaded/internal/diag"
+)
+
+// rangeKind tells an opening range marker from a closing one.
+type rangeKind int
+
+const (
+	rangeStart rangeKind = iota
+	rangeEnd
+)
+
+// rangePos locates a token in a document of token lines.
+type rangePos struct {
+	line, idx int
+}
+
+// before reports whether p comes before q in the document.
+func (p rangePos) before(q rangePos) bool {
+	return p.line < q.line || (p.line == q.line && p.idx < q.idx)
+}
+
+// rangeFrame is an open range or forward marker waiting to be applied.
+type rangeFrame struct {
+	marker    caseMarker
+	token     string
+	start     rangePos
+	remaining int // words still to count for a forward marker
+}
+
+// parseRangeMarker parses range markers like "(up:start)" or "(cap:end)".
+// Any case marker without a count can open or close a range.
+func parseRangeMarker(token string) (caseMarker, rangeKind, bool) {
+	m, ok := ParseMarker(token)
+	if !ok {
+		return caseMarker{}, 0, false
+	}
+
+	var kind rangeKind
+	switch m.Phase {
+	case "start":
+		kind = rangeStart
+	case "end":
+		kind = rangeEnd
+	default:
+		return caseMarker{}, 0, false
+	}
+	cm, ok := caseMarkerFrom(m)
+	if !ok || cm.hasCount || cm.quote {
+		return caseMarker{}, 0, false
+	}
+	return cm, kind, true
+}
+
+// rangeDoc holds the token lines being rewritten by ApplyRangeMarkers.
+// Tokens are never deleted while ranges are open, only flagged, so the
+// recorded positions of open frames stay valid.
+type rangeDoc struct {
+	lines   [][]string
+	removed [][]bool // consumed markers and words merged into another
+	owned   [][]bool // words already transformed by an inner range
+	opts    CaseOptions
+}
+
+func newRangeDoc(lines [][]string, opts CaseOptions) *rangeDoc {
+	d := &rangeDoc{
+		lines:   lines,
+		removed: make([][]bool, len(lines)),
+		owned:   make([][]bool, len(lines)),
+		opts:    opts,
+	}
+	for i, line := range lines {
+		d.removed[i] = make([]bool, len(line))
+		d.owned[i] = make([]bool, len(line))
+	}
+	return d
+}
+
+// isWord reports whether the token at p counts as a word for markers.
+func (d *rangeDoc) isWord(p rangePos) bool {
+	token := d.lines[p.line][p.idx]
+	if d.removed[p.line][p.idx] || d.opts.isMarker(token) {
+		return false
+	}
+	return d.opts.CountPunctuation || !isPunctuationToken(token)
+}
+
+// apply closes the frame: it transforms the words after the opening
+// marker and before end that no inner range has claimed, and removes
+// the opening marker.
+func (d *rangeDoc) apply(f *rangeFrame, end rangePos) {
+	d.removed[f.start.line][f.start.idx] = true
+
+	var targets []rangePos
+	for p := f.start; ; {
+		p.idx++
+		for p.line < len(d.lines) && p.idx >= len(d.lines[p.line]) {
+			p = rangePos{line: p.line + 1}
+		}
+		if !p.before(end) || p.line >= len(d.lines) {
+			break
+		}
+		if d.isWord(p) && !d.owned[p.line][p.idx] {
+			targets = append(targets, p)
+		}
+	}
+	if len(targets) == 0 {
+		return
+	}
+
+	span := make([]string, len(targets))
+	for i, p := range targets {
+		span[i] = d.lines[p.line][p.idx]
+	}
+	span = f.marker.caseFunc()(span, d.opts.Lang)
+	for i, p := range targets {
+		if i < len(span) {
+			d.lines[p.line][p.idx] = span[i]
+			d.owned[p.line][p.idx] = true
+			continue
+		}
+		// merged into the first word by an identifier marker
+		d.removed[p.line][p.idx] = true
+	}
+}
+
+// compact returns the token lines without removed tokens.
+func (d *rangeDoc) compact() [][]string {
+	out := make([][]string, len(d.lines))
+	for i, line := range d.lines {
+		kept := make([]string, 0, len(line))
+		for j, token := range line {
+			if !d.removed[i][j] {
+				kept = append(kept, token)
+			}
+		}
+		out[i] = kept
+	}
+	return out
+}
+
+// ApplyRangeMarkers applies case markers that target following words
+// instead of previous ones. It works on a whole document of token lines,
+// so ranges may span several lines.
+//
+// Two forms are supported:
+//   - (up:start) ... (up:end) applies the marker to every word in between;
+//     modes go after the phase, as in (cap:start, keep)
+//   - (up, +3) applies the marker to the next three words
+//
+// Any case marker can be used, e.g. (cap:start) or (snake, +2). Ranges
+// may nest; an inner range wins over an outer one for the words it covers.
+// As with ApplyCaseRules, punctuation tokens are not counted as words
+// unless opts.CountPunctuation is set.
+//
+// An unclosed start marker or an end marker without a start is left in
+// the text as a literal and reported as a diagnostic.
+//
+// Example:
+//
+//	Input:  [["(up:start)", "hello", "(cap:start)", "big", "(cap:end)", "world", "(up:end)"]]
+//	Output: [["HELLO", "Big", "WORLD"]]
+func ApplyRangeMarkers(lines [][]string, opts CaseOptions) ([][]string, []diag.Diagnostic) {
+	d := newRangeDoc(lines, opts)
+	var open []*rangeFrame
+	var diags []diag.Diagnostic
+
+	for li, line := range lines {
+		for ti, token := range line {
+			pos := rangePos{line: li, idx: ti}
+
+			if m, kind, ok := parseRangeMarker(token); ok {
+				if kind == rangeStart {
+					open = append(open, &rangeFrame{marker: m, token: token, start: pos})
+					continue
+				}
+				idx := lastOpenRange(open, m.name)
+				if idx < 0 {
+					diags = append(diags, diag.Diagnostic{
+						Line:    li + 1,
+						Message: fmt.Sprintf("range end marker %s has no matching start", token),
+					})
+					continue
+				}
+				d.apply(open[idx], pos)
+				d.removed[li][ti] = true
+				open = append(open[:idx], open[idx+1:]...)
+				continue
+			}
+
+			if m, ok := parseCaseMarker(token); ok && m.forward {
+				open = append(open, &rangeFrame{marker: m, token: token, start: pos, remaining: m.count})
+				continue
+			}
+
+			if !d.isWord(pos) {
+				continue
+			}
+			// count this word for pending forward markers, innermost first
+			for i := len(open) - 1; i >= 0; i-- {
+				f := open[i]
+				if !f.marker.forward {
+					continue
+				}
+				f.remaining--
+				if f.remaining == 0 {
+					d.apply(f, rangePos{line: li, idx: ti + 1})
+					open = append(open[:i], open[i+1:]...)
+				}
+			}
+		}
+	}
+
+	end := rangePos{line: len(lines)}
+	for i := len(open) - 1; i >= 0; i-- {
+		f := open[i]
+		if f.marker.forward {
+			// fewer words than the count: apply to what is available
+			d.apply(f, end)
+			continue
+		}
+		diags = append(diags, diag.Diagnostic{
+			Line:    f.start.line + 1,
+			Message: fmt.Sprintf("range marker %s is never closed", f.token),
+		})
+	}
+
+	sort.SliceStable(diags, func(i, j int) bool { return diags[i].Line < diags[j].Line })
+	return d.compact(), diags
+}
+
+// lastOpenRange returns the index of the innermost open range (not a
+// forward marker) with the given marker name, or -1.
+func lastOpenRange(open []*rangeFrame, name string) int {
+	for i := len(open) - 1; i >= 0; i-- {
+		if !open[i].marker.forward && open[i].marker.name == name {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,290 @@
+package transform
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// abbreviations end with a period that does not end the sentence.
+// Single letters (initials, e.g., U.S.) are handled separately.
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true,
+	"sr": true, "jr": true, "st": true, "mt": true, "vs": true,
+	"etc": true, "inc": true, "ltd": true, "co": true, "corp": true,
+	"no": true, "fig": true, "vol": true, "approx": true, "dept": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "jun": true,
+	"jul": true, "aug": true, "sep": true, "sept": true, "oct": true,
+	"nov": true, "dec": true,
+}
+
+// SentenceStarts returns the indices of the tokens that begin a sentence:
+// the first word, and the first word after each sentence end. Tokens are
+// as produced by Tokenize.
+//
+// A sentence ends at ".", "!" or "?" (for Greek also ";", the Greek
+// question mark), except for:
+//   - ellipses, "..." or "…", which often trail off mid-sentence
+//   - the period of an abbreviation like "Mr." or "etc." or of an initial
+//     like the "e" in "e.g."
+//   - a decimal point, as in "3.14"
+//   - "!" or "?" right before a closing quote, since a dialogue tag may
+//     follow, as in "stop!" she said
+//
+// Quotes, markers and other punctuation are never counted as words, so
+// the word after an opening quote can start a sentence.
+//
+// Example:
+//
+//	Input:  ["hello", ".", "mr", ".", "smith", "said", "\"hi", "!", "\""]
+//	Output: [0, 2]
+func SentenceStarts(tokens []string, lang Lang) []int {
+	var starts []int
+	s := newSentenceScanner(lang)
+	s.startLine(tokens)
+	for i := range tokens {
+		if s.next(tokens, i) {
+			starts = append(starts, i)
+		}
+	}
+	return starts
+}
+
+// sentenceScanner walks tokens and tracks whether the next word begins
+// a sentence. The state carries over from one line to the next.
+type sentenceScanner struct {
+	atStart bool
+	lang    Lang
+	profile SpacingProfile
+	closing []bool // tokens of the current line that start with a closing quote
+	markers CustomMarkers
+}
+
+func newSentenceScanner(lang Lang) *sentenceScanner {
+	return &sentenceScanner{atStart: true, lang: lang, profile: SpacingFor(lang)}
+}
+
+// startLine prepares the scanner for the tokens of a new line.
+func (s *sentenceScanner) startLine(tokens []string) {
+	s.closing = closingQuotes(tokens, s.profile)
+}
+
+// next consumes tokens[i] and reports whether it is a word that begins
+// a sentence.
+func (s *sentenceScanner) next(tokens []string, i int) bool {
+	token := tokens[i]
+	switch {
+	case IsMarker(token) || s.markers.IsMarker(token) || isPunctuationToken(token):
+		if isSentenceEnd(tokens, i, s.lang, s.closing) {
+			s.atStart = true
+		}
+	case hasLetterOrDigit(token):
+		start := s.atStart
+		s.atStart = false
+		return start
+	}
+	return false
+}
+
+// closingQuotes marks the tokens that start with a closing quote, pairing
+// the quotes of the line the way FixQuotes does. It returns nil when
+// there are none.
+func closingQuotes(tokens []string, profile SpacingProfile) []bool {
+	hasQuote := false
+	for _, token := range tokens {
+		hasQuote = hasQuote || strings.ContainsAny(token, quoteChars)
+	}
+	if !hasQuote {
+		return nil
+	}
+
+	var closing []bool
+	text := strings.Join(tokens, " ")
+	s := quoteScanner{profile: profile}
+	offset := 0
+	for t, token := range tokens {
+		for i := range token {
+			m, _ := s.next(text, offset+i, 0)
+			if i == 0 && m.role == closingQuote {
+				if closing == nil {
+					closing = make([]bool, len(tokens))
+				}
+				closing[t] = true
+			}
+		}
+		offset += len(token) + 1
+	}
+	return closing
+}
+
+// isSentenceEnd reports whether tokens[i] is punctuation that ends a
+// sentence. closing marks the tokens that start with a closing quote.
+func isSentenceEnd(tokens []string, i int, lang Lang, closing []bool) bool {
+	prev, next := "", ""
+	if i > 0 {
+		prev = tokens[i-1]
+	}
+	if i+1 < len(tokens) {
+		next = tokens[i+1]
+	}
+
+	switch tokens[i] {
+	case "!", "?":
+		return i+1 >= len(closing) || !closing[i+1]
+	case ";", string(GreekQuestionMark):
+		return lang == LangGreek
+	case ".":
+	default:
+		return false
+	}
+	switch {
+	case prev == "." || next == "." || prev == "…":
+		// part of an ellipsis
+		return false
+	case isAbbreviation(prev):
+		return false
+	case endsWithDigit(prev) && startsWithDigit(next):
+		// decimal point
+		return false
+	}
+	return true
+}
+
+// isAbbreviation reports whether word is written with a period that does
+// not end the sentence: a known abbreviation or a single letter.
+func isAbbreviation(word string) bool {
+	// only the last word counts, as in "Mr or 0"A: quotes may be spaced
+	// apart later
+	for i := len(word); i > 0; {
+		r, size := utf8.DecodeLastRuneInString(word[:i])
+		i -= size
+		if !isWordRune(r) && !isApostrophe(word, i) {
+			word = word[i+size:]
+			break
+		}
+	}
+	if utf8.RuneCountInString(word) == 1 {
+		r, _ := utf8.DecodeRuneInString(word)
+		return unicode.IsLetter(r)
+	}
+	return abbreviations[strings.ToLower(word)]
+}
+
+func hasLetterOrDigit(token string) bool {
+	return strings.IndexFunc(token, func(r rune) bool {
+		return unicode.IsLetter(r) || unicode.IsDigit(r)
+	}) >= 0
+}
+
+func endsWithDigit(s string) bool {
+	r, _ := utf8.DecodeLastRuneInString(s)
+	return unicode.IsDigit(r)
+}
+
+func startsWithDigit(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsDigit(r)
+}
+
+// CapitalizeSentences capitalizes the first word of every sentence in a
+// document of token lines, see SentenceStarts. A sentence may continue
+// on the next line; an empty line always starts a new one. Only the first
+// letter changes, and words that already contain a capital (iPhone) are
+// left alone.
+//
+// For English (LangDefault and LangEnglish) it also writes the pronoun
+// "i" as "I", including in contractions like "i'm".
+//
+// Example:
+//
+//	Input:  [["hello", ".", "i", "think", "it's", "fine"]]
+//	Output: [["Hello", ".", "I", "think", "it's", "fine"]]
+func CapitalizeSentences(lines [][]string, lang Lang) [][]string {
+	return CapitalizeSentencesWithOptions(lines, CaseOptions{Lang: lang})
+}
+
+// CapitalizeSentencesWithOptions is CapitalizeSentences for opts.Lang
+// that does not count opts.CustomMarkers as words either.
+func CapitalizeSentencesWithOptions(lines [][]string, opts CaseOptions) [][]string {
+	lang := opts.Lang
+	english := lang == LangDefault || lang == LangEnglish
+	s := newSentenceScanner(lang)
+	s.markers = opts.CustomMarkers
+	for _, line := range lines {
+		if len(line) == 0 {
+			s.atStart = true
+			continue
+		}
+		s.startLine(line)
+		for i, token := range line {
+			if s.next(line, i) {
+				line[i] = capitalizeFirstLetter(token, lang)
+			}
+			if english {
+				line[i] = capitalizePronounI(line[i])
+			}
+		}
+	}
+	return lines
+}
+
+// capitalizeFirstLetter uppercases the first letter of word, skipping
+// leading quotes and punctuation, unless the word has a capital already
+// or starts with a digit.
+func capitalizeFirstLetter(word string, lang Lang) string {
+	// a sentence starting with a number stays as it is, even when
+	// FixQuotes later joins a word to it, as in 0"a
+	i := strings.IndexFunc(word, isWordRune)
+	if i < 0 {
+		return word
+	}
+	r, size := utf8.DecodeRuneInString(word[i:])
+	if !unicode.IsLetter(r) {
+		return word
+	}
+	// only the part up to a quote counts: FixQuotes may split it off
+	part := word[i:]
+	if end := strings.IndexAny(part, quoteChars); end >= 0 {
+		part = part[:end]
+	}
+	if strings.IndexFunc(part, unicode.IsUpper) >= 0 {
+		return word
+	}
+	return word[:i] + titleRune(r, lang) + word[i+size:]
+}
+
+// capitalizePronounI turns the English pronoun "i", alone or in a
+// contraction like "i'm", into "I". The pronoun may be glued to quotes,
+// as in said"i", which FixQuotes later splits off.
+func capitalizePronounI(word string) string {
+	if !strings.Contains(word, "i") {
+		return word
+	}
+	var b strings.Builder
+	// start is the offset of the current part, between quotes that are
+	// not apostrophes inside a word
+	start := 0
+	flush := func(end int) {
+		part := word[start:end]
+		if part == "i" || strings.HasPrefix(part, "i'") || strings.HasPrefix(part, "i’") {
+			part = "I" + part[1:]
+		}
+		b.WriteString(part)
+		start = end
+	}
+	for i, r := range word {
+		if !strings.ContainsRune(quoteChars, r) {
+			continue
+		}
+		prev, _ := utf8.DecodeLastRuneInString(word[:i])
+		next, _ := utf8.DecodeRuneInString(word[i+utf8.RuneLen(r):])
+		if (r == '\'' || r == '’') && isWordRune(prev) && isWordRune(next) {
+			continue
+		}
+		flush(i)
+		b.WriteRune(r)
+		start += utf8.RuneLen(r)
+	}
+	flush(len(word))
+	return b.String()
+}
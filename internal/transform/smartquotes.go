@@ -0,0 +1,121 @@
+package transform
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// SmartQuotes replaces straight quotes with the typographic quotes of the
+// language profile, see SpacingFor. It expects the output of FixQuotes
+// and pairs quotes the same way, nested ones included. Apostrophes inside
+// words, as in don't, and leading elisions, as in '90s or 'til, become ’.
+//
+// When the profile uses guillemets as quotes, GuillemetSpace is written
+// inside them as FixQuotesWithProfile does.
+//
+// Example:
+//
+//	Input:  `"don't," she said, 'not in the '90s'`
+//	Output: `“don’t,” she said, ‘not in the ’90s’`
+func SmartQuotes(text string, profile SpacingProfile) string {
+	return SmartQuotesWithState(text, profile, QuoteState{})
+}
+
+// SmartQuotesWithState is SmartQuotes for one line of a document, starting
+// with the quotes MatchQuotes found open at the start of the line.
+func SmartQuotesWithState(text string, profile SpacingProfile, state QuoteState) string {
+	if !strings.ContainsAny(text, `"'`) {
+		return text
+	}
+
+	var b strings.Builder
+	b.Grow(len(text) + 16)
+	var stack [8]openQuote
+	s := quoteScanner{profile: profile, open: append(stack[:0], state.open...)}
+	space := profile.GuillemetSpace
+
+	for i := 0; i < len(text); {
+		ch, size := utf8.DecodeRuneInString(text[i:])
+		m, _ := s.next(text, i, 0)
+		i += size
+		if ch != '"' && ch != '\'' {
+			b.WriteRune(ch)
+			continue
+		}
+
+		quotes := profile.DoubleQuotes
+		if ch == '\'' {
+			quotes = profile.SingleQuotes
+		}
+		switch m.role {
+		case openingQuote, reopeningQuote:
+			b.WriteRune(quotes[0])
+			if isGuillemet(quotes[0]) && space != 0 {
+				b.WriteRune(space)
+			}
+		case closingQuote:
+			if isGuillemet(quotes[1]) && space != 0 {
+				b.WriteRune(space)
+			}
+			b.WriteRune(quotes[1])
+		default:
+			// an apostrophe
+			b.WriteRune('’')
+		}
+	}
+	return b.String()
+}
+
+// StraightenQuotes turns the typographic quotes of the profile, and the
+// apostrophe ’, back into straight quotes, dropping the GuillemetSpace
+// SmartQuotes writes inside guillemets. It undoes SmartQuotes, so the
+// pipeline reads its own output the same way as the original text.
+//
+// Example, for French:
+//
+//	Input:  "il a dit «\u00a0c’est “vrai”\u00a0»"
+//	Output: "il a dit \"c'est 'vrai'\""
+func StraightenQuotes(text string, profile SpacingProfile) string {
+	double, single := profile.DoubleQuotes, profile.SingleQuotes
+	if !strings.ContainsAny(text, string([]rune{double[0], double[1], single[0], single[1], '’'})) {
+		return text
+	}
+	space := rune(-1)
+	if isGuillemet(double[0]) && profile.GuillemetSpace != 0 {
+		space = profile.GuillemetSpace
+	}
+
+	var b strings.Builder
+	b.Grow(len(text))
+	for i := 0; i < len(text); {
+		r, size := utf8.DecodeRuneInString(text[i:])
+		i += size
+		switch r {
+		case double[0]:
+			b.WriteByte('"')
+			if next, size := utf8.DecodeRuneInString(text[i:]); next == space {
+				i += size
+			}
+		case double[1]:
+			b.WriteByte('"')
+		case single[0], single[1], '’':
+			b.WriteByte('\'')
+		case space:
+			if next, _ := utf8.DecodeRuneInString(text[i:]); next != double[1] {
+				b.WriteRune(r)
+			}
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+func isGuillemet(r rune) bool {
+	return r == '«' || r == '»'
+}
+
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
@@ -0,0 +1,80 @@
+package transform
+
+// Spacing rules that differ between languages.
+const (
+	// NoBreakSpace is U+00A0, used in French before ':' and inside « ».
+	NoBreakSpace = '\u00a0'
+	// NarrowNoBreakSpace is U+202F, used in French before ';', '!' and '?'.
+	NarrowNoBreakSpace = '\u202f'
+	// GreekQuestionMark is U+037E, which looks like ';' and is the
+	// question mark in Greek text.
+	GreekQuestionMark = '\u037e'
+	// GreekAnoTeleia is U+0387, the Greek semicolon (a raised dot). It is
+	// usually typed as the middle dot U+00B7, its canonical equivalent.
+	GreekAnoTeleia = '\u0387'
+	middleDot      = '\u00b7'
+)
+
+// SpacingProfile holds the language-specific rules of the punctuation
+// and quote stages.
+type SpacingProfile struct {
+	// Punctuation sets how marks are split and spaced. Nil means
+	// DefaultPunctuation.
+	Punctuation PunctuationClasses
+	// SpaceBefore gives attach-left marks that are written after a fixed
+	// space instead of right after the word, e.g. '!' in French.
+	SpaceBefore map[rune]rune
+	// Guillemets are the opening and closing guillemet, « and » in most
+	// languages but » and « in German.
+	Guillemets [2]rune
+	// GuillemetSpace, if set, is written just inside guillemets.
+	GuillemetSpace rune
+	// DoubleQuotes and SingleQuotes are the opening and closing
+	// typographic quotes written by SmartQuotes.
+	DoubleQuotes [2]rune
+	SingleQuotes [2]rune
+}
+
+// SpacingFor returns the spacing profile of a language:
+//   - fr: a narrow no-break space before ; ! ? and a no-break space
+//     before : and inside « »
+//   - de: guillemets point inwards, »like this«, and typographic quotes
+//     are „these“ and ‚these‘
+//   - el: ; (or U+037E) is the question mark and · the semicolon, both
+//     attach left
+//   - en, es and the default: the standard rules (¿ and ¡ always attach
+//     to the following word)
+//
+// Typographic quotes are “these” and ‘these’ in English and Turkish, and
+// «these» with “these” inside in French, Spanish and Greek.
+func SpacingFor(lang Lang) SpacingProfile {
+	p := SpacingProfile{
+		Guillemets:   [2]rune{'«', '»'},
+		DoubleQuotes: [2]rune{'“', '”'},
+		SingleQuotes: [2]rune{'‘', '’'},
+	}
+	switch lang {
+	case LangFrench:
+		p.SpaceBefore = map[rune]rune{
+			':': NoBreakSpace,
+			';': NarrowNoBreakSpace,
+			'!': NarrowNoBreakSpace,
+			'?': NarrowNoBreakSpace,
+		}
+		p.GuillemetSpace = NoBreakSpace
+		p.DoubleQuotes, p.SingleQuotes = p.Guillemets, p.DoubleQuotes
+	case LangGerman:
+		p.Guillemets = [2]rune{'»', '«'}
+		p.DoubleQuotes = [2]rune{'„', '“'}
+		p.SingleQuotes = [2]rune{'‚', '‘'}
+	case LangSpanish:
+		p.DoubleQuotes, p.SingleQuotes = p.Guillemets, p.DoubleQuotes
+	case LangGreek:
+		p.Punctuation = DefaultPunctuation()
+		p.Punctuation[GreekQuestionMark] = AttachLeft
+		p.Punctuation[GreekAnoTeleia] = AttachLeft
+		p.Punctuation[middleDot] = AttachLeft
+		p.DoubleQuotes, p.SingleQuotes = p.Guillemets, p.DoubleQuotes
+	}
+	return p
+}
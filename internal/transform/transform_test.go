@@ -2,7 +2,12 @@ package transform
 
 import (
 	"reflect"
+	"strings"
 	"testing"
+	"unicode"
+	"unicode/utf8"
+
+	"go-reloaded/internal/testutil"
 )
 
 func TestConvertHexAndBin(t *testing.T) {
@@ -26,6 +31,16 @@ func TestConvertHexAndBin(t *testing.T) {
 			input:    []string{"1A", "(hex)", "and", "FF", "(hex)"},
 			expected: []string{"26", "and", "255"},
 		},
+		{
+			name:     "hex after another marker",
+			input:    []string{"1E", "(cap)", "(hex)"},
+			expected: []string{"30", "(cap)"},
+		},
+		{
+			name:     "repeated hex marker",
+			input:    []string{"1E", "(hex)", "(hex)"},
+			expected: []string{"48"},
+		},
 		{
 			name:     "invalid hex - keeps both word and marker",
 			input:    []string{"XYZ", "(hex)", "test"},
@@ -41,6 +56,16 @@ func TestConvertHexAndBin(t *testing.T) {
 			input:    []string{"hello", "world"},
 			expected: []string{"hello", "world"},
 		},
+		{
+			name:     "tolerant hex marker syntax",
+			input:    []string{"1E", "( HEX )", "files"},
+			expected: []string{"30", "files"},
+		},
+		{
+			name:     "hex marker with arguments kept",
+			input:    []string{"1E", "(hex, 2)", "files"},
+			expected: []string{"1E", "(hex, 2)", "files"},
+		},
 		{
 			name:     "hex with punctuation",
 			input:    []string{"1E", "(hex).", "test"},
@@ -188,6 +213,166 @@ func TestApplyCaseRules(t *testing.T) {
 			input:    []string{"this", "is", "exciting", "(up, 2)"},
 			expected: []string{"this", "IS", "EXCITING"},
 		},
+		{
+			name:     "swap case single word",
+			input:    []string{"hELLO", "(swap)"},
+			expected: []string{"Hello"},
+		},
+		{
+			name:     "sentence case multiple words",
+			input:    []string{"THE", "QUICK", "FOX", "(sentence, 3)"},
+			expected: []string{"The", "quick", "fox"},
+		},
+		{
+			name:     "snake case merges words",
+			input:    []string{"user", "account", "id", "(snake, 3)"},
+			expected: []string{"user_account_id"},
+		},
+		{
+			name:     "kebab case merges words",
+			input:    []string{"see", "User", "Account", "(kebab, 2)"},
+			expected: []string{"see", "user-account"},
+		},
+		{
+			name:     "camel case merges words",
+			input:    []string{"User", "ACCOUNT", "id", "(camel, 3)"},
+			expected: []string{"userAccountId"},
+		},
+		{
+			name:     "pascal case merges words",
+			input:    []string{"user", "account", "(pascal, 2)", "field"},
+			expected: []string{"UserAccount", "field"},
+		},
+		{
+			name:     "identifier marker count exceeds available words",
+			input:    []string{"user", "id", "(snake, 5)"},
+			expected: []string{"user_id"},
+		},
+		{
+			name:     "identifier marker at start is consumed",
+			input:    []string{"(snake, 2)", "hello"},
+			expected: []string{"hello"},
+		},
+		{
+			name:     "capitalize keep mode preserves inner capitals",
+			input:    []string{"iphone", "mcDonald", "(cap, keep)"},
+			expected: []string{"iphone", "McDonald"},
+		},
+		{
+			name:     "capitalize keep mode with count",
+			input:    []string{"old", "mcDonald", "farm", "(cap, 2, keep)"},
+			expected: []string{"old", "McDonald", "Farm"},
+		},
+		{
+			name:     "capitalize compound mode",
+			input:    []string{"well-known", "o'neil", "(cap, 2, compound)"},
+			expected: []string{"Well-Known", "O'Neil"},
+		},
+		{
+			name:     "unknown capitalize mode kept as literal",
+			input:    []string{"hello", "(cap, loud)"},
+			expected: []string{"hello", "(cap, loud)"},
+		},
+		{
+			name:     "mode on non-cap marker kept as literal",
+			input:    []string{"hello", "(up, keep)"},
+			expected: []string{"hello", "(up, keep)"},
+		},
+		{
+			name:     "count skips punctuation tokens",
+			input:    []string{"hello", ",", "world", "(up, 2)"},
+			expected: []string{"HELLO", ",", "WORLD"},
+		},
+		{
+			name:     "count skips quote-only tokens",
+			input:    []string{"say", "'", "hi", "(cap, 2)"},
+			expected: []string{"Say", "'", "Hi"},
+		},
+		{
+			name:     "single marker after punctuation targets previous word",
+			input:    []string{"hello", "!", "(up)"},
+			expected: []string{"HELLO", "!"},
+		},
+		{
+			name:     "single marker with only punctuation before kept as literal",
+			input:    []string{",", "(up)"},
+			expected: []string{",", "(up)"},
+		},
+		{
+			name:     "identifier marker keeps skipped punctuation after merged word",
+			input:    []string{"user", ",", "account", "(snake, 2)"},
+			expected: []string{"user_account", ","},
+		},
+		{
+			name:     "uppercase marker name",
+			input:    []string{"hello", "(UP)"},
+			expected: []string{"HELLO"},
+		},
+		{
+			name:     "marker with inner spaces",
+			input:    []string{"hello", "( up )"},
+			expected: []string{"HELLO"},
+		},
+		{
+			name:     "count without space after comma",
+			input:    []string{"one", "two", "(up,2)"},
+			expected: []string{"ONE", "TWO"},
+		},
+		{
+			name:     "count separated by whitespace",
+			input:    []string{"one", "two", "(up 2)"},
+			expected: []string{"ONE", "TWO"},
+		},
+		{
+			name:     "named arguments",
+			input:    []string{"mcDonald", "farm", "(cap, count=2, mode=keep)"},
+			expected: []string{"McDonald", "Farm"},
+		},
+		{
+			name:     "extra argument kept as literal",
+			input:    []string{"test", "(up, 2, extra)"},
+			expected: []string{"test", "(up, 2, extra)"},
+		},
+		{
+			name:     "unknown named argument kept as literal",
+			input:    []string{"test", "(up, size=2)"},
+			expected: []string{"test", "(up, size=2)"},
+		},
+		{
+			name:     "forward marker kept as literal",
+			input:    []string{"hello", "(up, +1)", "world"},
+			expected: []string{"hello", "(up, +1)", "world"},
+		},
+		{
+			name:     "unknown marker kept as literal",
+			input:    []string{"hello", "(shout)"},
+			expected: []string{"hello", "(shout)"},
+		},
+		{
+			name:     "quote scope applies to the whole quotation",
+			input:    []string{"He", "said", "\"go", "now\"", "(up, quote)"},
+			expected: []string{"He", "said", "\"GO", "NOW\""},
+		},
+		{
+			name:     "quote scope count stops at the opening quote",
+			input:    []string{"He", "said", "\"go", "now\"", "(up, 3, scope=quote)"},
+			expected: []string{"He", "said", "\"GO", "NOW\""},
+		},
+		{
+			name:     "quote scope with spaced quotes and punctuation",
+			input:    []string{"he", "said", "\"", "go", "now", "!", "\"", ".", "(cap, quote)"},
+			expected: []string{"he", "said", "\"", "Go", "Now", "!", "\"", "."},
+		},
+		{
+			name:     "quote scope takes the outer quotation",
+			input:    []string{"\"say", "'hi'", "now\"", "(up, quote)"},
+			expected: []string{"\"SAY", "'HI'", "NOW\""},
+		},
+		{
+			name:     "quote scope without a quotation kept as literal",
+			input:    []string{"a", "\"b\"", "c", "(up, quote)"},
+			expected: []string{"a", "\"b\"", "c", "(up, quote)"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -200,6 +385,68 @@ func TestApplyCaseRules(t *testing.T) {
 	}
 }
 
+func TestParseMarker(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected Marker
+		valid    bool
+	}{
+		{"(up)", Marker{Name: "up"}, true},
+		{"( UP )", Marker{Name: "up"}, true},
+		{"(up, 2)", Marker{Name: "up", Args: []MarkerArg{{Value: "2"}}}, true},
+		{"(up,2)", Marker{Name: "up", Args: []MarkerArg{{Value: "2"}}}, true},
+		{"(up 2)", Marker{Name: "up", Args: []MarkerArg{{Value: "2"}}}, true},
+		{"(up, +3)", Marker{Name: "up", Args: []MarkerArg{{Value: "+3"}}}, true},
+		{"(cap, 2, KEEP)", Marker{Name: "cap", Args: []MarkerArg{{Value: "2"}, {Value: "keep"}}}, true},
+		{"(cap, count = 2, mode=keep)", Marker{Name: "cap", Args: []MarkerArg{{Key: "count", Value: "2"}, {Key: "mode", Value: "keep"}}}, true},
+		{"(up:start)", Marker{Name: "up", Phase: "start"}, true},
+		{"( cap : END )", Marker{Name: "cap", Phase: "end"}, true},
+		{"(up, )", Marker{}, false},
+		{"(up,, 2)", Marker{}, false},
+		{"(up", Marker{}, false},
+		{"up)", Marker{}, false},
+		{"()", Marker{}, false},
+		{"(2)", Marker{}, false},
+		{"(up, 2) x", Marker{}, false},
+		{"(up, count=)", Marker{}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result, valid := ParseMarker(tt.input)
+			if valid != tt.valid {
+				t.Fatalf("ParseMarker(%q) valid = %v, want %v", tt.input, valid, tt.valid)
+			}
+			if valid && !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ParseMarker(%q) = %+v, want %+v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestUnescape(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"\\(up)", "(up)"},
+		{"see \\(low\\) here", "see (low) here"},
+		{"\\\\(up)", "\\(up)"},
+		{"C:\\dir", "C:\\dir"},
+		{"no escapes", "no escapes"},
+		{"trailing \\", "trailing \\"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := Unescape(tt.input)
+			if result != tt.expected {
+				t.Errorf("Unescape(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestCapitalize(t *testing.T) {
 	tests := []struct {
 		input    string
@@ -212,6 +459,9 @@ func TestCapitalize(t *testing.T) {
 		{"", ""},
 		{"SHOUTING", "Shouting"},
 		{"αλφα", "Αλφα"}, // Greek Unicode
+		{"\"hi!\"", "\"Hi!\""},
+		{"'HELLO", "'Hello"},
+		{"...", "..."},
 	}
 
 	for _, tt := range tests {
@@ -224,6 +474,109 @@ func TestCapitalize(t *testing.T) {
 	}
 }
 
+func TestCaseConversionLang(t *testing.T) {
+	tests := []struct {
+		name     string
+		fn       func(string, Lang) string
+		input    string
+		lang     Lang
+		expected string
+	}{
+		{"upper german sharp s", ToUpper, "straße", LangDefault, "STRASSE"},
+		{"upper turkish dotted i", ToUpper, "istanbul", LangTurkish, "İSTANBUL"},
+		{"upper default i", ToUpper, "istanbul", LangDefault, "ISTANBUL"},
+		{"lower turkish dotless i", ToLower, "ISPARTA", LangTurkish, "ısparta"},
+		{"lower turkish dotted capital", ToLower, "İZMİR", LangTurkish, "izmir"},
+		{"lower greek final sigma", ToLower, "ΟΔΥΣΣΕΥΣ", LangDefault, "οδυσσευς"},
+		{"lower greek lone sigma", ToLower, "Σ", LangDefault, "σ"},
+		{"upper greek drops accents", ToUpper, "καλημέρα", LangGreek, "ΚΑΛΗΜΕΡΑ"},
+		{"upper greek default keeps accents", ToUpper, "καλημέρα", LangDefault, "ΚΑΛΗΜΈΡΑ"},
+		{"capitalize titlecase digraph", CapitalizeLang, "ǆungla", LangDefault, "ǅungla"},
+		{"capitalize turkish i", CapitalizeLang, "izmir", LangTurkish, "İzmir"},
+		{"capitalize sharp s", CapitalizeLang, "ßa", LangDefault, "Ssa"},
+		{"capitalize greek final sigma", CapitalizeLang, "ΟΔΟΣ", LangDefault, "Οδος"},
+		{"swap greek final sigma", SwapCase, "ΛΟΓΟΣ", LangDefault, "λογος"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := tt.fn(tt.input, tt.lang)
+			if result != tt.expected {
+				t.Errorf("%s: got %q, want %q", tt.name, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyCaseRulesWithOptionsLang(t *testing.T) {
+	input := []string{"istanbul", "ve", "izmir", "(up, 3)"}
+	expected := []string{"İSTANBUL", "VE", "İZMİR"}
+	result := ApplyCaseRulesWithOptions(input, CaseOptions{Lang: LangTurkish})
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("ApplyCaseRulesWithOptions(%v)\n  got: %v\n want: %v", input, result, expected)
+	}
+}
+
+func TestCapitalizeWithOptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		opts     CapitalizeOptions
+		expected string
+	}{
+		{"iPhone", CapitalizeOptions{}, "Iphone"},
+		{"iPhone", CapitalizeOptions{Keep: true}, "IPhone"},
+		{"mcDonald", CapitalizeOptions{Keep: true}, "McDonald"},
+		{"well-known", CapitalizeOptions{}, "Well-known"},
+		{"well-known", CapitalizeOptions{Compound: true}, "Well-Known"},
+		{"o'neil", CapitalizeOptions{Compound: true}, "O'Neil"},
+		{"d’artagnan", CapitalizeOptions{Compound: true}, "D’Artagnan"},
+		{"don't", CapitalizeOptions{Compound: true}, "Don't"},
+		{"JEAN-LUC", CapitalizeOptions{Compound: true}, "Jean-Luc"},
+		{"mcDonald-smith", CapitalizeOptions{Keep: true, Compound: true}, "McDonald-Smith"},
+		{"", CapitalizeOptions{Keep: true}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := CapitalizeWithOptions(tt.input, LangDefault, tt.opts)
+			if result != tt.expected {
+				t.Errorf("CapitalizeWithOptions(%q, %+v) = %q, want %q", tt.input, tt.opts, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestApplyCaseRulesCountPunctuation(t *testing.T) {
+	input := []string{"hello", ",", "world", "(up, 2)"}
+	expected := []string{"hello", ",", "WORLD"}
+	result := ApplyCaseRulesWithOptions(input, CaseOptions{CountPunctuation: true})
+	if !reflect.DeepEqual(result, expected) {
+		t.Errorf("ApplyCaseRulesWithOptions(%v)\n  got: %v\n want: %v", input, result, expected)
+	}
+}
+
+func TestSwapCase(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"hello", "HELLO"},
+		{"WORLD", "world"},
+		{"tEsT", "TeSt"},
+		{"a1-b", "A1-B"},
+		{"", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			result := SwapCase(tt.input, LangDefault)
+			if result != tt.expected {
+				t.Errorf("SwapCase(%q) = %q, want %q", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestParseMarkerCount(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -239,6 +592,10 @@ func TestParseMarkerCount(t *testing.T) {
 		{"empty count", "(up, )", 0, false},
 		{"non-numeric", "(up, abc)", 0, false},
 		{"large count", "(up, 100)", 100, true},
+		{"no space after comma", "(up,2)", 2, true},
+		{"whitespace separator", "(up 2)", 2, true},
+		{"named count", "(up, count=4)", 4, true},
+		{"uppercase name", "(UP, 3)", 3, true},
 	}
 
 	for _, tt := range tests {
@@ -295,6 +652,11 @@ func TestFixArticles(t *testing.T) {
 			input:    []string{"a", "elephant", "a", "igloo", "a", "octopus", "a", "umbrella"},
 			expected: []string{"an", "elephant", "an", "igloo", "an", "octopus", "an", "umbrella"},
 		},
+		{
+			name:     "marker between article and word",
+			input:    []string{"a", "(up)", "apple"},
+			expected: []string{"an", "(up)", "apple"},
+		},
 	}
 
 	for _, tt := range tests {
@@ -346,6 +708,41 @@ func TestApplyPunctuationRules(t *testing.T) {
 			input:    "Hello , world ! This is amazing .",
 			expected: "Hello, world! This is amazing.",
 		},
+		{
+			name:     "spaces inside parentheses removed",
+			input:    "read ( see the appendix , please ) now",
+			expected: "read (see the appendix, please) now",
+		},
+		{
+			name:     "literal marker left untouched",
+			input:    "stray (up:end) here ,ok",
+			expected: "stray (up:end) here, ok",
+		},
+		{
+			name:     "malformed marker keeps its spacing",
+			input:    "this (up,  3x ) too ,ok",
+			expected: "this (up,  3x ) too, ok",
+		},
+		{
+			name:     "ellipsis rune and percent attach left",
+			input:    "wait … it was 50 % ,really",
+			expected: "wait… it was 50%, really",
+		},
+		{
+			name:     "dashes get a space on each side",
+			input:    "word —word and 1990– 2000",
+			expected: "word — word and 1990 – 2000",
+		},
+		{
+			name:     "inverted marks attach right",
+			input:    "dijo: ¿ qué ? ¡ hola !",
+			expected: "dijo: ¿qué? ¡hola!",
+		},
+		{
+			name:     "brackets",
+			input:    "see [ note 3 ]now and ( this )",
+			expected: "see [note 3] now and (this)",
+		},
 	}
 
 	for _, tt := range tests {
@@ -358,6 +755,132 @@ func TestApplyPunctuationRules(t *testing.T) {
 	}
 }
 
+func TestApplyPunctuationRulesWithClasses(t *testing.T) {
+	classes := DefaultPunctuation()
+	classes['/'] = NoSpace
+	delete(classes, '%')
+
+	input := "this and / or that , 50 %"
+	expected := "this and/or that, 50 %"
+	if result := ApplyPunctuationRulesWithClasses(input, classes); result != expected {
+		t.Errorf("ApplyPunctuationRulesWithClasses(%q)\n  got: %q\n want: %q", input, result, expected)
+	}
+	if !classes.IsPunctuation('/') || classes.IsPunctuation('%') || !PunctuationClasses(nil).IsPunctuation('%') {
+		t.Errorf("IsPunctuation does not follow the classes")
+	}
+}
+
+func TestSpacingProfiles(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     Lang
+		input    string
+		expected string
+	}{
+		{"french spaces before high punctuation", LangFrench, "Quoi ?Vraiment ! Voici : rien ;", "Quoi\u202f? Vraiment\u202f! Voici\u00a0: rien\u202f;"},
+		{"french group gets one space", LangFrench, "Vraiment ?!", "Vraiment\u202f?!"},
+		{"french guillemets", LangFrench, "il a dit « oui »", "il a dit «\u00a0oui\u00a0»"},
+		{"english guillemets", LangEnglish, "he said « yes »", "he said «yes»"},
+		{"german guillemets point inwards", LangGerman, "er sagte » ja « und", "er sagte »ja« und"},
+		{"spanish inverted marks", LangSpanish, "¿ qué ? ¡ hola !", "¿qué? ¡hola!"},
+		{"greek question mark", LangGreek, "τι κάνεις ;καλά", "τι κάνεις; καλά"},
+		{"greek ano teleia", LangGreek, "καλά · ευχαριστώ", "καλά· ευχαριστώ"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := SpacingFor(tt.lang)
+			result := FixQuotesWithProfile(ApplyPunctuationRulesWithProfile(tt.input, profile), profile)
+			if result != tt.expected {
+				t.Errorf("%s: got %q, want %q", tt.name, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseLang(t *testing.T) {
+	for _, code := range []string{"", "en", "FR", " de ", "es", "el", "tr"} {
+		if _, err := ParseLang(code); err != nil {
+			t.Errorf("ParseLang(%q): %v", code, err)
+		}
+	}
+	if _, err := ParseLang("xx"); err == nil {
+		t.Errorf("ParseLang(%q) succeeded, want an error", "xx")
+	}
+}
+
+func TestSentenceStarts(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     Lang
+		input    []string
+		expected []int
+	}{
+		{"full stops", LangDefault, []string{"one", ".", "two", "!", "three", "?", "four"}, []int{0, 2, 4, 6}},
+		{"abbreviation", LangDefault, []string{"ask", "Mr", ".", "smith", "."}, []int{0}},
+		{"initials", LangDefault, []string{"e", ".", "g", ".", "this"}, []int{0}},
+		{"decimal", LangDefault, []string{"pi", "is", "3", ".", "14", "."}, []int{0}},
+		{"ellipsis", LangDefault, []string{"well", ".", ".", ".", "maybe", "…", "not"}, []int{0}},
+		{"dialogue tag", LangDefault, []string{"\"stop", "!", "\"", "she", "said", "."}, []int{0}},
+		{"quote after full stop", LangDefault, []string{"done", ".", "\"next", "one\""}, []int{0, 2}},
+		{"markers are not words", LangDefault, []string{"(cap)", "done", ".", "(up, +1)", "next"}, []int{1, 4}},
+		{"greek question mark", LangGreek, []string{"τι", ";", "καλά"}, []int{0, 2}},
+		{"semicolon elsewhere", LangDefault, []string{"one", ";", "two"}, []int{0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := SentenceStarts(tt.input, tt.lang)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("SentenceStarts(%q) = %v, want %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestCapitalizeSentences(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     Lang
+		input    [][]string
+		expected [][]string
+	}{
+		{"first words", LangDefault,
+			[][]string{{"hello", ".", "world", "!"}},
+			[][]string{{"Hello", ".", "World", "!"}}},
+		{"pronoun i", LangEnglish,
+			[][]string{{"so", "i", "think", "i'm", "\"i", "am\""}},
+			[][]string{{"So", "I", "think", "I'm", "\"I", "am\""}}},
+		{"i is a word in other languages", LangFrench,
+			[][]string{{"voilà", "i", "."}},
+			[][]string{{"Voilà", "i", "."}}},
+		{"words with capitals are kept", LangDefault,
+			[][]string{{"iPhone", "sales", ".", "eBay", "too"}},
+			[][]string{{"iPhone", "sales", ".", "eBay", "too"}}},
+		{"sentence continues on next line", LangDefault,
+			[][]string{{"one", "and"}, {"two", "."}, {"three"}},
+			[][]string{{"One", "and"}, {"two", "."}, {"Three"}}},
+		{"empty line starts a sentence", LangDefault,
+			[][]string{{"title"}, nil, {"body"}},
+			[][]string{{"Title"}, nil, {"Body"}}},
+		{"leading quote", LangDefault,
+			[][]string{{"\"quoted", "start\""}},
+			[][]string{{"\"Quoted", "start\""}}},
+		{"turkish dotted i", LangTurkish,
+			[][]string{{"istanbul", "."}},
+			[][]string{{"İstanbul", "."}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := CapitalizeSentences(tt.input, tt.lang)
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("CapitalizeSentences() = %q, want %q", result, tt.expected)
+			}
+		})
+	}
+}
+
 func TestFixQuotes(t *testing.T) {
 	tests := []struct {
 		name     string
@@ -394,6 +917,46 @@ func TestFixQuotes(t *testing.T) {
 			input:    "It's John's \"book\"",
 			expected: "It's John's \"book\"",
 		},
+		{
+			name:     "opening quote glued to a word",
+			input:    "word' quoted'",
+			expected: "word 'quoted'",
+		},
+		{
+			name:     "leading elisions are not quotes",
+			input:    "rock 'til the '90s, 'ended '",
+			expected: "rock 'til the '90s, 'ended'",
+		},
+		{
+			name:     "possessives and trailing elisions are not quotes",
+			input:    "the students' books , goin' ' home '",
+			expected: "the students' books , goin' 'home'",
+		},
+		{
+			name:     "rock 'n' roll",
+			input:    "rock 'n' roll ' now '",
+			expected: "rock 'n' roll 'now'",
+		},
+		{
+			name:     "plural closes a single-quoted quotation",
+			input:    "' the students' said",
+			expected: "'the students' said",
+		},
+		{
+			name:     "single quotes nested in double quotes",
+			input:    "\" He said ' hi ' to me \"",
+			expected: "\"He said 'hi' to me\"",
+		},
+		{
+			name:     "double quotes nested in single quotes",
+			input:    "' a \" b \" c '",
+			expected: "'a \"b\" c'",
+		},
+		{
+			name:     "unclosed nested quote closes with the outer one",
+			input:    "\" a ' b \" c",
+			expected: "\"a 'b\" c",
+		},
 	}
 
 	for _, tt := range tests {
@@ -405,3 +968,394 @@ func TestFixQuotes(t *testing.T) {
 		})
 	}
 }
+
+func TestIsApostrophe(t *testing.T) {
+	tests := []struct {
+		text      string
+		i         int
+		quoteOpen bool
+		expected  bool
+	}{
+		{"don't", 3, false, true},
+		{"o'clock", 1, false, true},
+		{"the '90s", 4, false, true},
+		{"'cause", 0, false, true},
+		{"'em'", 0, false, false},
+		{"'em'", 0, true, true},
+		{"rock 'n' roll", 5, false, true},
+		{"rock 'n' roll", 7, false, true},
+		{"students' books", 8, false, true},
+		{"students' books", 8, true, false},
+		{"goin' home", 4, false, true},
+		{"ol' man", 2, false, true},
+		{"said' hi", 4, false, false},
+		{"'hello", 0, false, false},
+		{"it's", 1, false, false},
+	}
+
+	for _, tt := range tests {
+		if got := IsApostrophe(tt.text, tt.i, tt.quoteOpen); got != tt.expected {
+			t.Errorf("IsApostrophe(%q, %d, %v) = %v, want %v", tt.text, tt.i, tt.quoteOpen, got, tt.expected)
+		}
+	}
+}
+
+func TestMatchQuotes(t *testing.T) {
+	lines := []string{
+		"\"It was late,",
+		"\"and dark.\"",
+		"he said \"what",
+		"« oui",
+		"non »",
+		"fin »",
+	}
+	states, diags := MatchQuotes(lines, SpacingFor(LangFrench))
+	var open []int
+	for _, state := range states {
+		open = append(open, len(state.open))
+	}
+	if want := []int{0, 1, 0, 0, 1, 0}; !reflect.DeepEqual(open, want) {
+		t.Errorf("MatchQuotes open quotes per line = %v, want %v", open, want)
+	}
+
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"line 3: quote \" is never closed",
+		"line 6: closing quote » has no opening quote",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MatchQuotes diagnostics = %q, want %q", got, want)
+	}
+
+	// the paired lines come out the same way as with FixQuotes
+	if got := FixQuotesWithState(lines[1], SpacingProfile{}, states[1]); got != "\"and dark.\"" {
+		t.Errorf("FixQuotesWithState(%q) = %q", lines[1], got)
+	}
+}
+
+func TestSmartQuotes(t *testing.T) {
+	tests := []struct {
+		name     string
+		lang     Lang
+		input    string
+		expected string
+	}{
+		{"english pairs", LangEnglish, `"hello" and 'bye'`, "“hello” and ‘bye’"},
+		{"apostrophes", LangDefault, `it's Ana's, isn't it`, "it’s Ana’s, isn’t it"},
+		{"leading elisions", LangDefault, `rock 'til the '90s, 'em'`, "rock ’til the ’90s, ‘em’"},
+		{"nested", LangDefault, `"say 'hi'" (or "no")`, "“say ‘hi’” (or “no”)"},
+		{"german", LangGerman, `"ja" und 'nein'`, "„ja“ und ‚nein‘"},
+		{"french guillemets", LangFrench, `il dit "c'est 'vrai'"`, "il dit «\u00a0c’est “vrai”\u00a0»"},
+		{"spanish guillemets", LangSpanish, `dijo "hola"`, "dijo «hola»"},
+		{"no quotes", LangDefault, "plain text", "plain text"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			profile := SpacingFor(tt.lang)
+			result := SmartQuotes(tt.input, profile)
+			if result != tt.expected {
+				t.Errorf("SmartQuotes(%q)\n  got: %q\n want: %q", tt.input, result, tt.expected)
+			}
+			// straightening gives back what FixQuotes reads the same way
+			if again := SmartQuotes(FixQuotesWithProfile(StraightenQuotes(result, profile), profile), profile); again != result {
+				t.Errorf("SmartQuotes(%q) does not survive a round trip: %q", result, again)
+			}
+		})
+	}
+}
+
+func TestApplyRangeMarkers(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     [][]string
+		expected  [][]string
+		diagLines []int
+	}{
+		{
+			name:     "explicit range",
+			input:    [][]string{{"a", "(up:start)", "big", "dog", "(up:end)", "barks"}},
+			expected: [][]string{{"a", "BIG", "DOG", "barks"}},
+		},
+		{
+			name:     "forward count",
+			input:    [][]string{{"(cap, +2)", "new", "york", "city"}},
+			expected: [][]string{{"New", "York", "city"}},
+		},
+		{
+			name:     "forward count skips punctuation",
+			input:    [][]string{{"(up, +2)", "hello", ",", "world"}},
+			expected: [][]string{{"HELLO", ",", "WORLD"}},
+		},
+		{
+			name:     "forward count exceeds available words",
+			input:    [][]string{{"(up, +5)", "only", "two"}},
+			expected: [][]string{{"ONLY", "TWO"}},
+		},
+		{
+			name:     "nested ranges inner wins",
+			input:    [][]string{{"(up:start)", "hello", "(cap:start)", "BIG", "(cap:end)", "world", "(up:end)"}},
+			expected: [][]string{{"HELLO", "Big", "WORLD"}},
+		},
+		{
+			name:     "range across lines",
+			input:    [][]string{{"(low:start)", "ONE"}, nil, {"TWO", "(low:end)", "THREE"}},
+			expected: [][]string{{"one"}, {}, {"two", "THREE"}},
+		},
+		{
+			name:     "identifier range merges words",
+			input:    [][]string{{"(snake:start)", "user", "account", "id", "(snake:end)"}},
+			expected: [][]string{{"user_account_id"}},
+		},
+		{
+			name:     "backward markers left for ApplyCaseRules",
+			input:    [][]string{{"(up:start)", "hello", "(low)", "(up:end)"}},
+			expected: [][]string{{"HELLO", "(low)"}},
+		},
+		{
+			name:      "unclosed range is kept and reported",
+			input:     [][]string{{"ok"}, {"(up:start)", "never", "closed"}},
+			expected:  [][]string{{"ok"}, {"(up:start)", "never", "closed"}},
+			diagLines: []int{2},
+		},
+		{
+			name:      "unmatched end is kept and reported",
+			input:     [][]string{{"stray", "(cap:end)"}},
+			expected:  [][]string{{"stray", "(cap:end)"}},
+			diagLines: []int{1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, diags := ApplyRangeMarkers(tt.input, CaseOptions{})
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ApplyRangeMarkers(%v)\n  got: %v\n want: %v", tt.input, result, tt.expected)
+			}
+			var lines []int
+			for _, d := range diags {
+				lines = append(lines, d.Line)
+			}
+			if !reflect.DeepEqual(lines, tt.diagLines) {
+				t.Errorf("ApplyRangeMarkers(%v) diagnostics on lines %v, want %v", tt.input, lines, tt.diagLines)
+			}
+		})
+	}
+}
+
+func TestApplyCustomMarkers(t *testing.T) {
+	markers, err := ParseCustomMarkers([]byte(`{
+		"markers": {
+			"brand":  {"action": "table", "table": {"iPhone": "iPhone", "github": "GitHub"}},
+			"Redact": {"action": "replace", "with": "█████"},
+			"em":     {"action": "wrap", "prefix": "*", "suffix": "*"},
+			"digits": {"action": "regex", "pattern": "[0-9]", "replace": "#"}
+		}
+	}`))
+	if err != nil {
+		t.Fatalf("ParseCustomMarkers: %v", err)
+	}
+
+	tests := []struct {
+		name     string
+		input    []string
+		expected []string
+	}{
+		{
+			name:     "table replaces with canonical spelling",
+			input:    []string{"my", "IPHONE", "(brand)"},
+			expected: []string{"my", "iPhone"},
+		},
+		{
+			name:     "table keeps unknown words",
+			input:    []string{"my", "phone", "(brand)"},
+			expected: []string{"my", "phone"},
+		},
+		{
+			name:     "replace with count",
+			input:    []string{"call", "555", "1234", "(redact, 2)"},
+			expected: []string{"call", "█████", "█████"},
+		},
+		{
+			name:     "wrap skips punctuation when counting",
+			input:    []string{"very", ",", "very", "(em, 2)"},
+			expected: []string{"*very*", ",", "*very*"},
+		},
+		{
+			name:     "regex substitution",
+			input:    []string{"pin", "1a2b", "(DIGITS)"},
+			expected: []string{"pin", "#a#b"},
+		},
+		{
+			name:     "marker at start kept as literal",
+			input:    []string{"(brand)", "x"},
+			expected: []string{"(brand)", "x"},
+		},
+		{
+			name:     "invalid count kept as literal",
+			input:    []string{"secret", "(redact, -1)"},
+			expected: []string{"secret", "(redact, -1)"},
+		},
+		{
+			name:     "built-in markers left alone",
+			input:    []string{"hello", "(up)"},
+			expected: []string{"hello", "(up)"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := ApplyCustomMarkers(tt.input, markers, CaseOptions{})
+			if !reflect.DeepEqual(result, tt.expected) {
+				t.Errorf("ApplyCustomMarkers(%v)\n  got: %v\n want: %v", tt.input, result, tt.expected)
+			}
+		})
+	}
+}
+
+func TestParseCustomMarkersErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+	}{
+		{"invalid json", `{"markers": `},
+		{"unknown field", `{"markers": {"x": {"action": "replace", "with": "y", "colour": "red"}}}`},
+		{"unknown action", `{"markers": {"x": {"action": "explode"}}}`},
+		{"shadows built-in", `{"markers": {"up": {"action": "replace", "with": "y"}}}`},
+		{"invalid name", `{"markers": {"two words": {"action": "replace", "with": "y"}}}`},
+		{"table without entries", `{"markers": {"x": {"action": "table"}}}`},
+		{"bad regex", `{"markers": {"x": {"action": "regex", "pattern": "("}}}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParseCustomMarkers([]byte(tt.config)); err == nil {
+				t.Errorf("ParseCustomMarkers(%s) succeeded, want error", tt.config)
+			}
+		})
+	}
+}
+
+// FuzzConvertHexAndBin checks that conversion never panics, never adds
+// tokens and keeps every token that is not a converted number or marker.
+func FuzzConvertHexAndBin(f *testing.F) {
+	for _, seed := range []string{
+		"1E (hex) files",
+		"101 (bin), test",
+		"\"FF\" (hex).",
+		"(hex) word",
+		"XYZ (hex) 102 (bin)",
+		"FFFFFFFFFFFFFFFFFFFF (hex)",
+		"-1 (bin) +1 (hex)",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		tokens := strings.Fields(input)
+		result := ConvertHexAndBin(append([]string(nil), tokens...))
+		if len(result) > len(tokens) {
+			t.Fatalf("ConvertHexAndBin(%q) = %q, has more tokens than the input", tokens, result)
+		}
+		for _, token := range result {
+			if utf8.ValidString(input) && !utf8.ValidString(token) {
+				t.Fatalf("ConvertHexAndBin(%q) produced invalid UTF-8 token %q", tokens, token)
+			}
+		}
+		// every output token is an input token or a converted number
+		kept := make(map[string]bool, len(tokens))
+		for _, token := range tokens {
+			kept[token] = true
+		}
+		for _, token := range result {
+			if !kept[token] && !strings.ContainsAny(token, "0123456789") {
+				t.Fatalf("ConvertHexAndBin(%q) = %q, token %q does not come from the input", tokens, result, token)
+			}
+		}
+	})
+}
+
+// FuzzFixQuotes checks that quote spacing never panics, keeps valid
+// UTF-8 valid and only ever changes whitespace and quote characters.
+func FuzzFixQuotes(f *testing.F) {
+	for _, seed := range []string{
+		"He said: ' hello '",
+		"\" hi \"and\" there \"",
+		"it's 'mixed \"quotes\" here'",
+		"“curly” and ‘single’",
+		"'",
+		"x ' ' y",
+		"rock 'n' roll",
+	} {
+		f.Add(seed)
+	}
+
+	f.Fuzz(func(t *testing.T, input string) {
+		result := FixQuotes(input)
+		if utf8.ValidString(input) && !utf8.ValidString(result) {
+			t.Fatalf("FixQuotes(%q) = %q, not valid UTF-8", input, result)
+		}
+		if got, want := quoteFree(result), quoteFree(input); got != want {
+			t.Fatalf("FixQuotes(%q) = %q, changed text other than quotes and spaces:\n  got: %q\n want: %q", input, result, got, want)
+		}
+	})
+}
+
+// quoteFree drops whitespace and quote characters, which FixQuotes may change.
+func quoteFree(s string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || strings.ContainsRune("\"'“”‘’", r) {
+			return -1
+		}
+		return r
+	}, s)
+}
+
+func BenchmarkApplyPunctuationRules(b *testing.B) {
+	benchmarkLines(b, ApplyPunctuationRules)
+}
+
+func BenchmarkFixQuotes(b *testing.B) {
+	benchmarkLines(b, FixQuotes)
+}
+
+func benchmarkLines(b *testing.B, fn func(string) string) {
+	lines := testutil.BenchLines(b)
+	size := 0
+	for _, line := range lines {
+		size += len(line)
+	}
+	b.SetBytes(int64(size))
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, line := range lines {
+			fn(line)
+		}
+	}
+}
+
+// TestHotPathAllocs guards the allocation-free scanning in the per-line
+// text stages: each call may allocate its output and nothing else.
+func TestHotPathAllocs(t *testing.T) {
+	lines := testutil.BenchLines(t)
+	for _, tt := range []struct {
+		name string
+		fn   func(string) string
+		max  float64 // allocations per line
+	}{
+		{"ApplyPunctuationRules", ApplyPunctuationRules, 1},
+		{"FixQuotes", FixQuotes, 1},
+	} {
+		allocs := testing.AllocsPerRun(20, func() {
+			for _, line := range lines {
+				tt.fn(line)
+			}
+		}) / float64(len(lines))
+		if allocs > tt.max {
+			t.Errorf("%s: %.2f allocations per line, want at most %v", tt.name, allocs, tt.max)
+		}
+	}
+}
@@ -0,0 +1,71 @@
+// Package reloaded lets other programs build a custom go-reloaded binary:
+// the standard pipeline and command line plus their own token stages.
+//
+//	package main
+//
+//	import "go-reloaded/reloaded"
+//
+//	func shout(tokens []string) []string { ... }
+//
+//	func main() {
+//		reloaded.Register(reloaded.AfterMarkers, reloaded.TransformFunc(shout))
+//		reloaded.Main()
+//	}
+package reloaded
+
+import (
+	"os"
+	"sync"
+
+	"go-reloaded/internal/cli"
+	"go-reloaded/internal/pipeline"
+)
+
+// Transform is a pipeline stage over the tokens of one line.
+type Transform = pipeline.Transform
+
+// TransformFunc adapts a func([]string) []string to Transform.
+type TransformFunc = pipeline.TransformFunc
+
+// Position is a point in the standard pipeline where a stage runs.
+type Position = pipeline.Position
+
+// Positions where registered stages run, in pipeline order.
+const (
+	BeforeNumbers = pipeline.BeforeNumbers
+	AfterNumbers  = pipeline.AfterNumbers
+	AfterArticles = pipeline.AfterArticles
+	AfterMarkers  = pipeline.AfterMarkers
+)
+
+var (
+	mu     sync.Mutex
+	stages []pipeline.Stage
+)
+
+// Register adds t to the pipeline at pos. Stages registered at the same
+// position run in registration order. Register is typically called from
+// main or an init function, before Main or ProcessText.
+func Register(pos Position, t Transform) {
+	mu.Lock()
+	defer mu.Unlock()
+	stages = append(stages, pipeline.Stage{Position: pos, Transform: t})
+}
+
+// registered returns a copy of the registered stages.
+func registered() []pipeline.Stage {
+	mu.Lock()
+	defer mu.Unlock()
+	return append([]pipeline.Stage(nil), stages...)
+}
+
+// ProcessText runs the standard pipeline plus the registered stages.
+func ProcessText(text string) string {
+	return pipeline.ProcessTextWithOptions(text, pipeline.Options{Stages: registered()})
+}
+
+// Main runs the standard go-reloaded command line with the registered
+// stages and exits the program.
+func Main() {
+	os.Exit(cli.Run(os.Args[1:], registered()))
+}